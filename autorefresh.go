@@ -0,0 +1,68 @@
+package levelcache
+
+import (
+	"context"
+	"time"
+)
+
+// AutoRefresh refreshes keys of the namespace every interval in the background, for the few hot values
+// which must stay fresh without waiting for a read to find them changed. Registering a key again replaces
+// its interval, an interval below one deregisters the keys like StopAutoRefresh.
+// Refreshes go on until StopAutoRefresh, Stop or Close, the failed ones are logged like those of Refresh.
+func (p *LevelCache) AutoRefresh(namespace string, keys []string, interval time.Duration) {
+	if interval <= 0 {
+		p.StopAutoRefresh(namespace, keys...)
+		return
+	}
+	p.amu.Lock()
+	defer p.amu.Unlock()
+	for _, key := range keys {
+		k := jointKey(namespace, key)
+		if stop, ok := p.refreshers[k]; ok {
+			close(stop)
+		}
+		stop := make(chan struct{})
+		p.refreshers[k] = stop
+		go p.autoRefresh(namespace, key, interval, stop)
+	}
+}
+
+// StopAutoRefresh deregisters keys of the namespace from AutoRefresh, a refresh running is left to finish
+func (p *LevelCache) StopAutoRefresh(namespace string, keys ...string) {
+	p.amu.Lock()
+	defer p.amu.Unlock()
+	for _, key := range keys {
+		k := jointKey(namespace, key)
+		if stop, ok := p.refreshers[k]; ok {
+			close(stop)
+			delete(p.refreshers, k)
+		}
+	}
+}
+
+// stopAutoRefresh deregisters every key from AutoRefresh
+func (p *LevelCache) stopAutoRefresh() {
+	p.amu.Lock()
+	defer p.amu.Unlock()
+	for k, stop := range p.refreshers {
+		close(stop)
+		delete(p.refreshers, k)
+	}
+}
+
+// autoRefresh refreshes key every interval until stop is closed or the cache is closed,
+// a refresh outlasting the interval delays the next one instead of running alongside it
+func (p *LevelCache) autoRefresh(namespace, key string, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = p.Refresh(context.Background(), namespace, key).Wait(context.Background())
+		case <-stop:
+			return
+		case <-p.done:
+			return
+		}
+	}
+}
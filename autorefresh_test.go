@@ -0,0 +1,39 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_AutoRefresh(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	var loads int32
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		atomic.AddInt32(&loads, 1)
+		return &Dish{ID: 84}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.lockKey("dish", "84"))
+
+	cache.AutoRefresh("dish", []string{"84"}, 20*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&loads) >= 3 }, time.Second, 5*time.Millisecond)
+
+	cache.StopAutoRefresh("dish", "84")
+	// a refresh may have been running
+	time.Sleep(50 * time.Millisecond)
+	stopped := atomic.LoadInt32(&loads)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&loads))
+
+	cache.AutoRefresh("dish", []string{"84"}, 20*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&loads) > stopped }, time.Second, 5*time.Millisecond)
+	cache.Stop()
+	assert.Empty(t, cache.refreshers)
+}
@@ -0,0 +1,36 @@
+package levelcache
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of its parent without its deadline and cancellation,
+// so that background work triggered by a call outlives it while its loaders still see the values of the call
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// backgroundContext bounds a background operation run with ctx by RedisOpTimeout
+func (p *LevelCache) backgroundContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.cfg.RedisOpTimeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.cfg.RedisOpTimeout)
+}
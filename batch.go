@@ -0,0 +1,84 @@
+package levelcache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type batchKey struct{}
+
+type batchEntry struct {
+	namespace string
+	key       string
+}
+
+// Batch defers the version checks of the reads of one request to a single pipeline run by Flush,
+// instead of a redis round trip per read. Values are served as without it, an outdated local copy
+// being replaced by the Start worker once its check ran.
+type Batch struct {
+	cache   *LevelCache
+	mu      sync.Mutex
+	pending []batchEntry
+	seen    map[batchEntry]bool
+}
+
+// WithBatch starts a Batch for the reads of one request. Reads made with the returned context,
+// by Batch.Get or by any code passing it on to the cache, defer their version checks to the batch.
+// Flush the batch once the request is served.
+func (p *LevelCache) WithBatch(ctx context.Context) (*Batch, context.Context) {
+	b := &Batch{cache: p, seen: make(map[batchEntry]bool)}
+	return b, context.WithValue(ctx, batchKey{}, b)
+}
+
+// Get is Get of the cache deferring the version check to the batch
+func (b *Batch) Get(ctx context.Context, key string, obj Cacheable, opts ...GetOption) error {
+	return b.cache.Get(context.WithValue(ctx, batchKey{}, b), key, obj, opts...)
+}
+
+func (b *Batch) add(namespace, key string) {
+	e := batchEntry{namespace: namespace, key: key}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.seen[e] {
+		b.seen[e] = true
+		b.pending = append(b.pending, e)
+	}
+}
+
+// Flush reads the versions of the keys read since the last Flush in one pipeline
+// and queues the updates of the outdated local entries, like a read outside of a batch.
+func (b *Batch) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.seen = make(map[batchEntry]bool)
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	cmds := make([]*redis.StringCmd, len(pending))
+	_, _ = b.cache.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, e := range pending {
+			cmds[i] = pipe.Get(ctx, b.cache.versionKey(e.namespace, e.key))
+		}
+		return nil
+	})
+	var firstErr error
+	for i, e := range pending {
+		latest, err := cmds[i].Result()
+		if err != nil && err != redis.Nil {
+			b.cache.versionCheckFailed(e.namespace, e.key, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		b.cache.versionCheckSucceeded()
+		if err == nil {
+			b.cache.applyVersion(e.namespace, e.key, latest)
+		}
+	}
+	return firstErr
+}
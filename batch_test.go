@@ -0,0 +1,46 @@
+package levelcache
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelCache_WithBatch(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	keys := []string{"51", "52", "53"}
+	for i, key := range keys {
+		assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 51 + i}))
+		assert.Equal(t, key, ObjectKey(&Dish{ID: 51 + i}))
+	}
+	cache.rdb.Incr(context.TODO(), cache.versionKey("dish", "52"))
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	batch, ctx := cache.WithBatch(context.TODO())
+	var dish Dish
+	for _, key := range keys {
+		assert.Nil(t, batch.Get(ctx, key, &dish))
+		assert.Nil(t, cache.Get(ctx, key, &dish))
+	}
+	assert.Empty(t, counter.commands["pipeline"])
+	for _, k := range counter.commands["get"] {
+		assert.False(t, strings.HasPrefix(k, cache.cacheKey("version", "")), "version read %s", k)
+	}
+	assert.Empty(t, cache.updates)
+
+	assert.Nil(t, batch.Flush(context.TODO()))
+	assert.Equal(t, []string{"3"}, counter.commands["pipeline"])
+	if assert.Len(t, cache.updates, 1) {
+		assert.Equal(t, "52", (<-cache.updates).key)
+	}
+	assert.Nil(t, batch.Flush(context.TODO()))
+	assert.Len(t, counter.commands["pipeline"], 1)
+}
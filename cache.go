@@ -2,14 +2,17 @@ package levelcache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/bsm/redislock"
 	"github.com/go-redis/redis/v8"
-	"github.com/jinzhu/copier"
-	jsoniter "github.com/json-iterator/go"
-	"github.com/patrickmn/go-cache"
+	"reflect"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,19 +21,130 @@ const (
 	defaultCacheInvalidInterval = 1440 * time.Minute //one day
 	defaultCleanupInterval      = 1441 * time.Minute
 	defaultMaxUpdateBuffer      = 100
+	defaultMaxWriteBuffer       = 1000
+	defaultMaxEventBuffer       = 1000
 	defaultUpdateLockInterval   = time.Minute
+	defaultRefreshConcurrency   = 10
+	defaultStaleExpiration      = 7 * defaultCacheInvalidInterval
+	defaultRedisOpTimeout       = 30 * time.Second
 )
 
+// NoExpiration as CacheExpiration makes values never expire, it is also the time to live reported for them
+const NoExpiration time.Duration = -1
+
+// WriteErrorPolicy is what a read does when writing the value it loaded to redis fails
+type WriteErrorPolicy int
+
+const (
+	// WriteErrorLog logs the failure and serves the loaded value, the default
+	WriteErrorLog WriteErrorPolicy = iota
+	// WriteErrorIgnore serves the loaded value silently
+	WriteErrorIgnore
+	// WriteErrorReturn fails the read with the write error
+	WriteErrorReturn
+)
+
+// Source is where a value returned by GetWithSource was served from
+type Source int
+
+const (
+	// SourceNone is reported when no value was served
+	SourceNone Source = iota
+	// SourceLocal is the local cache
+	SourceLocal
+	// SourceRedis is redis
+	SourceRedis
+	// SourceLoader is the data loader
+	SourceLoader
+	// SourceStale is the stale copy served by ServeStaleOnError
+	SourceStale
+	// SourceDefault is the WithDefault object
+	SourceDefault
+	// SourceSeed is the seed function of GetOrSeed
+	SourceSeed
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceLocal:
+		return "local"
+	case SourceRedis:
+		return "redis"
+	case SourceLoader:
+		return "loader"
+	case SourceStale:
+		return "stale"
+	case SourceDefault:
+		return "default"
+	case SourceSeed:
+		return "seed"
+	default:
+		return "none"
+	}
+}
+
+var defaultJointEncoder = newJointEncoder(cacheKeyJoint)
+
+var _ Cache = (*LevelCache)(nil)
+
 type (
-	levelCache struct {
-		c       *cache.Cache
+	// LevelCache is the two level cache created by New and NewLocalOnly, see Cache
+	LevelCache struct {
+		c       *localCache
 		rdb     *redis.Client
-		loaders map[string]DataLoader
+		loaders map[string]DataLoaderWithTTL
+		batches map[string]BatchDataLoader
+		types   map[string]reflect.Type
+		lmu     sync.RWMutex
 		cfg     CacheConfig
 		version map[string]int64
-		updates chan versionInfo
-		stop    chan struct{}
-		locker  *redislock.Client
+		vmu     sync.RWMutex
+		// namespaces are the per namespace settings and serializers the known ones by ID, guarded by nsmu
+		namespaces  map[string]namespaceConfig
+		serializers map[byte]Serializer
+		nsmu        sync.RWMutex
+		updates     chan versionInfo
+		umu         sync.RWMutex // guards updates, replaced by SetUpdateBuffer
+		stop        chan struct{}
+		locker      *redislock.Client
+		closed      sync.Once
+		done        chan struct{}
+		sampling    sync.Once // starts sampleMemory with the first SetRedisMemoryLimit
+		stats       *stats
+		lockWindow  lockWindow
+		coalescer   coalescer
+		debouncer   debouncer
+		events      eventStream
+		// writes are the pending SetAsync redis writes drained by the Start worker,
+		// started tells whether that worker accepts them and running whether it is alive,
+		// spawned and stopped whether Start and Stop were called, guarded by wmu
+		writes  chan writeTask
+		flushed chan struct{}
+		started bool
+		running bool
+		spawned bool
+		stopped bool
+		wmu     sync.RWMutex
+		// replicas serve the reads tolerating lag, next picks them round robin
+		replicas []*redis.Client
+		next     uint32
+		// invalidations and evictions are the callbacks registered by OnInvalidate and OnLocalEviction, guarded by imu
+		invalidations []func(namespace, key string)
+		evictions     []func(namespace, key string, reason EvictReason)
+		imu           sync.RWMutex
+		// degraded is set by a failed version check under DegradeOnVersionError, atomically
+		degraded int32
+		// refreshers close the AutoRefresh loops of the keys by joint namespace and key, guarded by amu
+		refreshers map[string]chan struct{}
+		amu        sync.Mutex
+		// middlewares wrap every DataLoader call, see UseLoaderMiddleware, guarded by lmu
+		middlewares []func(DataLoader) DataLoader
+		// negatives are the keys the loaders did not find, nil unless NegativeCacheSize is set
+		negatives *negativeCache
+		// reloads counts the ReloadNamespace calls removing the values of each namespace, guarded by lmu
+		reloads map[string]int
+		// keyNames restores the keys shortened to fit MaxKeyLength in the keys split back into their parts
+		keyNames keyNames
 	}
 
 	CacheConfig struct {
@@ -38,15 +152,121 @@ type (
 		RedisDb         int
 		RedisPassword   string
 		RedisPoolSize   int
-		CacheExpiration time.Duration
+		CacheExpiration time.Duration // one day when unset, NoExpiration makes values never expire
 		CleanupInterval time.Duration
 		LockInterval    time.Duration
-		MaxUpdateBuffer int
+		MaxUpdateBuffer int // pending version updates, further ones are dropped and counted in Stats, see SetUpdateBuffer
+		// LocalExpiration and RedisExpiration override CacheExpiration for their level,
+		// e.g. a short local one picks up the changes of other instances sooner without reloading more often
+		LocalExpiration time.Duration
+		RedisExpiration time.Duration
+		// MaxWriteBuffer bounds the pending SetAsync writes, SetAsync writes synchronously once it is full
+		MaxWriteBuffer int
+		// MaxEventBuffer bounds the events waiting for the consumer of Events, further ones are dropped
+		MaxEventBuffer int
+		// KeyEncoder builds the composite redis and local keys, jointKey with escaping by default
+		KeyEncoder KeyEncoder
+		// KeySeparator joins the parts of the keys built by the default KeyEncoder, "#$#" when empty.
+		// It must not contain a backslash, which escapes it inside the parts.
+		KeySeparator string
+		// MaxKeyLength bounds the keys built by the KeyEncoder, unbounded when zero. The last part of longer keys,
+		// the key of the value for data keys, is replaced by "sha256:" and the hex sha256 of that part,
+		// the whole key is when that is still too long. It cannot be below the 71 bytes of such a key.
+		MaxKeyLength int
+		// RefreshConcurrency bounds the number of keys RefreshMany reloads at once
+		RefreshConcurrency int
+		// SlowLoaderThreshold makes loaders running longer than it be reported, disabled when zero
+		SlowLoaderThreshold time.Duration
+		Logger              Logger
+		Hooks               Hooks
+		// ServeStaleOnError keeps a copy of every loaded value for StaleExpiration
+		// and serves it when the data loader fails
+		ServeStaleOnError bool
+		StaleExpiration   time.Duration
+		// ConsistencyCheckRate is the share of local hits verified against the redis version,
+		// a diverged local entry is replaced by the redis one. Disabled when zero.
+		ConsistencyCheckRate float64
+		// LocalShards stripes the local cache over that many locks, one by default
+		LocalShards int
+		// MaxConcurrentLoads limits the concurrent loaders per namespace, see SetMaxConcurrentLoads
+		MaxConcurrentLoads map[string]int
+		// RedisMaxRetries is how many times a transient redis read error is retried, -1 disables retrying
+		RedisMaxRetries int
+		// DegradeOnVersionError reports the cache as Degraded by Health from a version check failing on redis
+		// until one succeeds, local hits being served without knowing whether they are stale meanwhile.
+		DegradeOnVersionError bool
+		// RedisOpTimeout bounds every background operation: the version updates and async writes of the worker,
+		// the delayed writes of WriteCoalesceWindow and Refresh, loader included. 30 seconds by default,
+		// a negative one leaves them unbounded.
+		RedisOpTimeout time.Duration
+		// LockWarnFailures failed reload lock attempts within LockWarnWindow log a contention warning,
+		// 1000 within a minute by default
+		LockWarnFailures int
+		LockWarnWindow   time.Duration
+		// LockRetryStrategy builds the strategy retrying a held reload lock, once per acquisition since
+		// strategies like redislock.ExponentialBackoff keep state. Acquisitions give up when it stops retrying
+		// or after the lock interval. Exponential backoff from 16 to 128 milliseconds by default.
+		LockRetryStrategy func() redislock.RetryStrategy
+		// LockMetadata is appended to the token of the reload locks, e.g. to tell the instance holding one
+		LockMetadata string
+		// MaxValueBytes is the largest serialized value written to the cache, unlimited when zero.
+		// Larger loaded values are still returned to the caller but never cached.
+		MaxValueBytes int
+		// ReadReplicaAddrs are redis replicas of RedisAddr serving the value and version reads,
+		// writes and locks always go to RedisAddr
+		ReadReplicaAddrs []string
+		// DisableVersioning skips version polling and version writes, values stay fresh by expiring only.
+		// It suits data immutable for its time to live, SetVersioningDisabled sets it per namespace.
+		DisableVersioning bool
+		// SingleInstance tells that this process is the only one writing to redis, so no version is read nor written:
+		// Set, Refresh and the deletes keep the local cache consistent on their own. It implies DisableVersioning.
+		SingleInstance bool
+		// HistoryDepth keeps that many values replaced by Set and Refresh, read back by History. Disabled when zero.
+		HistoryDepth int
+		// WriteErrorPolicy tells what a read does when writing the value it loaded to redis fails,
+		// ForceReload reads always return the failure.
+		WriteErrorPolicy WriteErrorPolicy
+		// WriteCoalesceWindow delays the redis writes of Set by that long, writes of the same key within the window
+		// are collapsed into the latest one while the local cache reflects each of them. Disabled when zero.
+		// Set then no longer reports redis failures, which are logged, and Close flushes the pending writes.
+		WriteCoalesceWindow time.Duration
+		// RefreshDebounce collapses the Refresh calls of a key made while one runs into it, as long as it started
+		// less than that long before. A collapsed call may miss a change made after the loader read the source.
+		// Disabled when zero, every Refresh reloads then.
+		RefreshDebounce time.Duration
+		// Encryptor encrypts the values stored in redis and the local cache, see NewAESEncryptor. Disabled when nil.
+		// Values written before enabling it are still read, values written with it need it to be read.
+		Encryptor Encryptor
+		// Serializer stores the values of the namespaces without their own, see SetNamespaceSerializer.
+		// JSONSerializer by default.
+		Serializer Serializer
+		// ReadSerializers decode the values they wrote without being used for writes, e.g. during a rolling deploy
+		// switching Serializer where nodes on both sides read the values of the others without flushing redis.
+		// JSONSerializer is always read.
+		ReadSerializers []Serializer
+		// NegativeCacheSize remembers up to that many keys the loader did not find for NegativeExpiration,
+		// reads of them failing with ErrNotFound without calling the loader again. They are kept apart from
+		// the local cache, the oldest going first once full, so that a burst of missing keys never evicts values.
+		// Disabled when zero.
+		NegativeCacheSize int
+		// NegativeExpiration is how long a missing key is remembered, a minute by default
+		NegativeExpiration time.Duration
+		// Clock times loaders, retries and memory samples, the wall clock by default.
+		// Expirations are kept by redis and the local cache on their own clocks.
+		Clock Clock
+		// MemorySampleInterval is how often the namespaces given a limit by SetRedisMemoryLimit are sampled,
+		// a minute by default
+		MemorySampleInterval time.Duration
+		// MemorySampler estimates the bytes a namespace holds in redis, by default from the MEMORY USAGE
+		// of a few random keys of the namespace
+		MemorySampler func(ctx context.Context, namespace string) (int64, error)
 	}
 
 	versionInfo struct {
 		dataKey   string
 		versionNo int64
+		namespace string
+		key       string
 	}
 )
 
@@ -54,50 +274,221 @@ func (p *CacheConfig) checkAndLoadDefault() error {
 	if p.RedisAddr == "" {
 		return fmt.Errorf("invalid redis connect addr")
 	}
+	if err := p.checkKeySeparator(); err != nil {
+		return err
+	}
+	if err := p.checkMaxKeyLength(); err != nil {
+		return err
+	}
+	p.loadDefault()
+	return nil
+}
+
+func (p *CacheConfig) checkKeySeparator() error {
+	if strings.Contains(p.KeySeparator, `\`) {
+		return fmt.Errorf("invalid key separator %q", p.KeySeparator)
+	}
+	return nil
+}
+
+func (p *CacheConfig) loadDefault() {
 	if p.RedisPoolSize == 0 {
 		p.RedisPoolSize = 40
 	}
 	if p.CacheExpiration == 0 {
 		p.CacheExpiration = defaultCacheInvalidInterval
 	}
+	if p.LocalExpiration == 0 {
+		p.LocalExpiration = p.CacheExpiration
+	}
+	if p.RedisExpiration == 0 {
+		p.RedisExpiration = p.CacheExpiration
+	}
 	if p.CleanupInterval == 0 {
 		p.CleanupInterval = defaultCleanupInterval
 	}
 	if p.LockInterval == 0 {
 		p.LockInterval = defaultUpdateLockInterval
 	}
+	if p.LockWarnFailures == 0 {
+		p.LockWarnFailures = defaultLockWarnFailures
+	}
+	if p.LockWarnWindow == 0 {
+		p.LockWarnWindow = defaultLockWarnWindow
+	}
+	if p.LockRetryStrategy == nil {
+		p.LockRetryStrategy = defaultLockRetryStrategy
+	}
 	if p.MaxUpdateBuffer == 0 {
 		p.MaxUpdateBuffer = defaultMaxUpdateBuffer
 	}
-	return nil
+	if p.MaxWriteBuffer == 0 {
+		p.MaxWriteBuffer = defaultMaxWriteBuffer
+	}
+	if p.MaxEventBuffer == 0 {
+		p.MaxEventBuffer = defaultMaxEventBuffer
+	}
+	if p.KeySeparator == "" {
+		p.KeySeparator = cacheKeyJoint
+	}
+	if p.KeyEncoder == nil {
+		p.KeyEncoder = newJointEncoder(p.KeySeparator)
+	}
+	if p.RefreshConcurrency == 0 {
+		p.RefreshConcurrency = defaultRefreshConcurrency
+	}
+	if p.RedisMaxRetries == 0 {
+		p.RedisMaxRetries = defaultRedisMaxRetries
+	}
+	if p.RedisOpTimeout == 0 {
+		p.RedisOpTimeout = defaultRedisOpTimeout
+	}
+	if p.StaleExpiration == 0 {
+		p.StaleExpiration = defaultStaleExpiration
+	}
+	if p.Logger == nil {
+		p.Logger = defaultLogger
+	}
+	if p.Clock == nil {
+		p.Clock = realClock{}
+	}
+	if p.NegativeExpiration == 0 {
+		p.NegativeExpiration = defaultNegativeExpiration
+	}
+	if p.MemorySampleInterval == 0 {
+		p.MemorySampleInterval = defaultMemorySampleInterval
+	}
+	if p.Serializer == nil {
+		p.Serializer = JSONSerializer
+	}
 }
 
-func New(cfg CacheConfig) (*levelCache, error) {
+func New(cfg CacheConfig) (*LevelCache, error) {
 	if err := cfg.checkAndLoadDefault(); err != nil {
 		return nil, err
 	}
-	lc := &levelCache{
-		c:       cache.New(cfg.CacheExpiration, cfg.CleanupInterval),
-		loaders: make(map[string]DataLoader),
-		cfg:     cfg,
-		version: make(map[string]int64),
-		updates: make(chan versionInfo, cfg.MaxUpdateBuffer),
-		stop:    make(chan struct{}, 1),
-	}
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.RedisAddr,
 		Password: cfg.RedisPassword,
 		DB:       cfg.RedisDb,
+		PoolSize: cfg.RedisPoolSize,
 	})
 	if err := rdb.Ping(context.TODO()).Err(); err != nil {
+		_ = rdb.Close()
+		return nil, err
+	}
+	replicas, err := dialReplicas(cfg)
+	if err != nil {
+		_ = rdb.Close()
 		return nil, err
 	}
+	lc := newLevelCache(cfg)
 	lc.rdb = rdb
+	lc.replicas = replicas
 	lc.locker = redislock.New(rdb)
+	if lc.cfg.MemorySampler == nil {
+		lc.cfg.MemorySampler = lc.redisMemoryUsage
+	}
 	return lc, nil
 }
 
-func (p *levelCache) RegisterLoader(namespace string, loader DataLoader) error {
+// NewLocalOnly creates a cache running without redis, the redis settings of cfg are ignored.
+// Values are loaded and kept in the local cache only, without versions nor locks,
+// the methods which cannot work without redis return ErrRedisDisabled.
+func NewLocalOnly(cfg CacheConfig) (*LevelCache, error) {
+	if err := cfg.checkKeySeparator(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkMaxKeyLength(); err != nil {
+		return nil, err
+	}
+	cfg.loadDefault()
+	return newLevelCache(cfg), nil
+}
+
+func newLevelCache(cfg CacheConfig) *LevelCache {
+	lc := &LevelCache{
+		c:          newLocalCache(cfg.LocalShards, cfg.LocalExpiration),
+		loaders:    make(map[string]DataLoaderWithTTL),
+		batches:    make(map[string]BatchDataLoader),
+		types:      make(map[string]reflect.Type),
+		cfg:        cfg,
+		version:    make(map[string]int64),
+		namespaces: make(map[string]namespaceConfig),
+		serializers: map[byte]Serializer{
+			JSONSerializer.ID(): JSONSerializer,
+			cfg.Serializer.ID(): cfg.Serializer,
+		},
+		updates: make(chan versionInfo, cfg.MaxUpdateBuffer),
+		stop:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stats:   new(stats),
+		writes:  make(chan writeTask, cfg.MaxWriteBuffer),
+		flushed: make(chan struct{}),
+	}
+	for _, s := range cfg.ReadSerializers {
+		if _, ok := lc.serializers[s.ID()]; !ok {
+			lc.serializers[s.ID()] = s
+		}
+	}
+	lc.refreshers = make(map[string]chan struct{})
+	lc.reloads = make(map[string]int)
+	if cfg.NegativeCacheSize > 0 {
+		lc.negatives = newNegativeCache(cfg.NegativeCacheSize, cfg.NegativeExpiration)
+	}
+	lc.coalescer.pending = make(map[string]writeTask)
+	lc.debouncer.refreshes = make(map[string]*RefreshHandle)
+	// forget the version of every local entry going away, so the version map only tracks cached keys
+	lc.c.OnEvicted(func(k string, _ interface{}, reason EvictReason) {
+		lc.vmu.Lock()
+		delete(lc.version, k)
+		lc.vmu.Unlock()
+		lc.evicted(k, reason)
+	})
+	for namespace, limit := range cfg.MaxConcurrentLoads {
+		lc.SetMaxConcurrentLoads(namespace, limit)
+	}
+	go lc.cleanup()
+	return lc
+}
+
+// localOnly tells a cache created by NewLocalOnly
+func (p *LevelCache) localOnly() bool {
+	return p.rdb == nil
+}
+
+// cleanup purges expired local entries until the cache is closed,
+// go-cache's own janitor could only be stopped by the garbage collector.
+func (p *LevelCache) cleanup() {
+	ticker := time.NewTicker(p.cfg.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.c.DeleteExpired()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// RegisterLoader registers the loader of the values missing from both levels in namespace.
+// Loaders are guarded by their own lock, they may be registered at any time, before or after Start
+// and while other goroutines read, reads of a namespace before its loader is registered fail with ErrNotFound.
+func (p *LevelCache) RegisterLoader(namespace string, loader DataLoader) error {
+	return p.RegisterLoaderWithTTL(namespace, withDefaultTTL(loader))
+}
+
+// RegisterLoaderWithTTL registers a loader also telling how long each loaded value stays valid
+func (p *LevelCache) RegisterLoaderWithTTL(namespace string, loader DataLoaderWithTTL) error {
+	if namespace == "" {
+		return fmt.Errorf("empty namespace of data loader")
+	}
+	if err := checkReservedNamespace(namespace); err != nil {
+		return err
+	}
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
 	if _, ok := p.loaders[namespace]; ok {
 		return fmt.Errorf("data loader [%s] existed", namespace)
 	}
@@ -105,148 +496,1144 @@ func (p *levelCache) RegisterLoader(namespace string, loader DataLoader) error {
 	return nil
 }
 
-func (p *levelCache) RegisterLoaders(loaders map[string]DataLoader) {
+// RegisterTypedLoader registers loader under the namespace of sample and records the type of sample,
+// reads of that namespace then fail with ErrTypeMismatch for objects of another type
+// and so do loaded objects of another type.
+func (p *LevelCache) RegisterTypedLoader(sample Cacheable, loader DataLoader) error {
+	if err := checkObject(sample, false); err != nil {
+		return err
+	}
+	namespace := sample.Namespace()
+	if err := p.RegisterLoader(namespace, loader); err != nil {
+		return err
+	}
+	p.lmu.Lock()
+	p.types[namespace] = reflect.TypeOf(sample)
+	p.lmu.Unlock()
+	return nil
+}
+
+// reservedNamespaces are the first parts of the internal keys, values of namespaces named alike would share them
+var reservedNamespaces = map[string]bool{hashKeyPart: true, "version": true, "stale": true, "lock": true, "history": true}
+
+// checkReservedNamespace rejects the namespaces named like the internal keys
+func checkReservedNamespace(namespace string) error {
+	if reservedNamespaces[namespace] {
+		return fmt.Errorf("%w: [%s]", ErrReservedNamespace, namespace)
+	}
+	return nil
+}
+
+// checkType makes sure obj has the type registered by RegisterTypedLoader for namespace, if any
+func (p *LevelCache) checkType(namespace string, obj Cacheable) error {
+	p.lmu.RLock()
+	t, ok := p.types[namespace]
+	p.lmu.RUnlock()
+	if ok && obj != nil && reflect.TypeOf(obj) != t {
+		return fmt.Errorf("%w: [%s] holds %s, got %T", ErrTypeMismatch, namespace, t, obj)
+	}
+	return nil
+}
+
+// RegisterBatchLoader registers a loader fetching many keys of the namespace at once,
+// bulk operations prefer it over the single key DataLoader.
+func (p *LevelCache) RegisterBatchLoader(namespace string, loader BatchDataLoader) error {
+	if namespace == "" {
+		return fmt.Errorf("empty namespace of batch data loader")
+	}
+	if err := checkReservedNamespace(namespace); err != nil {
+		return err
+	}
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	if _, ok := p.batches[namespace]; ok {
+		return fmt.Errorf("batch data loader [%s] existed", namespace)
+	}
+	p.batches[namespace] = loader
+	return nil
+}
+
+// RegisterLoaders registers all loaders at once like RegisterLoader, replacing the loaders already registered
+// for their namespaces along with the types recorded by RegisterTypedLoader.
+// The loaders of reserved namespaces are logged and skipped.
+func (p *LevelCache) RegisterLoaders(loaders map[string]DataLoader) {
 	if len(loaders) > 0 {
+		p.lmu.Lock()
+		defer p.lmu.Unlock()
 		for namespace, loader := range loaders {
-			p.loaders[namespace] = loader
+			if err := checkReservedNamespace(namespace); err != nil {
+				p.cfg.Logger.Printf("skip data loader: %v", err)
+				continue
+			}
+			p.loaders[namespace] = withDefaultTTL(loader)
+			delete(p.types, namespace)
+		}
+	}
+}
+
+// Namespaces returns the sorted namespaces having a data loader or batch data loader registered
+func (p *LevelCache) Namespaces() []string {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	namespaces := make([]string, 0, len(p.loaders)+len(p.batches))
+	for namespace := range p.loaders {
+		namespaces = append(namespaces, namespace)
+	}
+	for namespace := range p.batches {
+		if _, ok := p.loaders[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
 		}
 	}
+	sort.Strings(namespaces)
+	return namespaces
 }
 
-func (p *levelCache) Start(ctx context.Context) {
+func (p *LevelCache) loader(namespace string) (DataLoaderWithTTL, bool) {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	loader, ok := p.loaders[namespace]
+	return loader, ok
+}
+
+func (p *LevelCache) batchLoader(namespace string) (BatchDataLoader, bool) {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	loader, ok := p.batches[namespace]
+	return loader, ok
+}
+
+// Start runs the background worker applying version updates and SetAsync writes with ctx,
+// each of them bounded by RedisOpTimeout.
+// The worker never calls loaders, they always receive the context of the Get or Refresh triggering them.
+// A cache runs a single worker, further calls return ErrAlreadyStarted even once it was stopped.
+func (p *LevelCache) Start(ctx context.Context) error {
+	p.wmu.Lock()
+	if p.spawned {
+		p.wmu.Unlock()
+		return ErrAlreadyStarted
+	}
+	p.spawned = true
+	p.started = true
+	p.running = true
+	p.wmu.Unlock()
 	go func() {
 		for {
 			select {
-			case update := <-p.updates:
-				_ = p.parseAndDo(ctx, update)
+			case update, ok := <-p.updateBuffer():
+				if !ok {
+					// replaced by SetUpdateBuffer, wait on the new buffer
+					continue
+				}
+				p.runTask("version update", func() {
+					ctx, cancel := p.backgroundContext(ctx)
+					defer cancel()
+					_ = p.parseAndDo(ctx, update)
+				})
+			case w := <-p.writes:
+				p.runTask("async write", func() {
+					p.write(ctx, w)
+				})
 			case <-p.stop:
-				close(p.stop)
-				close(p.updates)
+				p.flushWrites(ctx)
+				p.wmu.Lock()
+				p.running = false
+				p.wmu.Unlock()
+				close(p.flushed)
 				return
 			}
 		}
 	}()
+	return nil
 }
 
-func (p *levelCache) Stop() {
+// runTask runs a task of the background worker, a panic is reported to the Logger and Hooks.OnWorkerPanic
+// and only drops that task so that the worker keeps processing the following ones.
+func (p *LevelCache) runTask(task string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.cfg.Logger.Printf("background %s panic: %v\n%s", task, r, debug.Stack())
+			if p.cfg.Hooks.OnWorkerPanic != nil {
+				p.cfg.Hooks.OnWorkerPanic(task, r)
+			}
+		}
+	}()
+	f()
+}
+
+// Stop stops the background worker and waits for the pending async writes to be flushed,
+// it also ends every AutoRefresh. It does nothing else when the worker was not started or is already stopped.
+func (p *LevelCache) Stop() {
+	p.stopAutoRefresh()
+	p.wmu.Lock()
+	if !p.spawned || p.stopped {
+		p.wmu.Unlock()
+		return
+	}
+	p.stopped = true
+	p.wmu.Unlock()
 	p.stop <- struct{}{}
+	<-p.flushed
+}
+
+// FlushLocal drops every local entry, the versions tracked for them and the keys remembered as missing, leaving redis untouched.
+// Following reads repopulate the local cache from redis.
+func (p *LevelCache) FlushLocal() {
+	p.c.Flush()
+	if p.negatives != nil {
+		p.negatives.flush()
+	}
+	p.vmu.Lock()
+	p.version = make(map[string]int64)
+	p.vmu.Unlock()
+}
+
+// Close stops the background worker and releases the redis connections, it is safe to call more than once.
+func (p *LevelCache) Close() error {
+	var err error
+	p.closed.Do(func() {
+		p.Stop()
+		p.coalescer.close()
+		close(p.done)
+		p.coalescer.flushes.Wait()
+		p.closeEvents()
+		if !p.localOnly() {
+			err = p.rdb.Close()
+		}
+		for _, replica := range p.replicas {
+			_ = replica.Close()
+		}
+	})
+	return err
 }
 
-func (p *levelCache) Get(ctx context.Context, key string, obj Cacheable) error {
+// Get fills obj with the value of key in the namespace of obj, opts tune this single call.
+// obj is always decoded from the serialized value, so the caller owns it and may mutate it freely
+// without affecting the cache or other callers.
+func (p *LevelCache) Get(ctx context.Context, key string, obj Cacheable, opts ...GetOption) error {
+	if err := checkObject(obj, true); err != nil {
+		return err
+	}
 	p.checkCacheUpdate(ctx, obj.Namespace(), key)
-	return p.get(ctx, key, obj)
+	_, err := p.get(ctx, key, obj, newGetOptions(opts))
+	return err
 }
 
-func (p *levelCache) get(ctx context.Context, key string, obj Cacheable) error {
-	k := jointKey(obj.Namespace(), key)
-	// read local cache
-	if content, ok := p.c.Get(k); ok {
-		if err := jsoniter.UnmarshalFromString(content.(string), obj); err != nil {
-			return err
+// GetWithSource works like Get and also returns where the value was served from.
+func (p *LevelCache) GetWithSource(ctx context.Context, key string, obj Cacheable, opts ...GetOption) (Source, error) {
+	if err := checkObject(obj, true); err != nil {
+		return SourceNone, err
+	}
+	p.checkCacheUpdate(ctx, obj.Namespace(), key)
+	return p.get(ctx, key, obj, newGetOptions(opts))
+}
+
+// GetLocal fills obj from the local cache only, without version check, redis or loader,
+// and reports false on a local miss. The value may be outdated until the version updates reached it.
+func (p *LevelCache) GetLocal(key string, obj Cacheable) (bool, error) {
+	if err := checkObject(obj, true); err != nil {
+		return false, err
+	}
+	if err := p.checkType(obj.Namespace(), obj); err != nil {
+		return false, err
+	}
+	if p.namespaceConfig(obj.Namespace()).localDisabled {
+		return false, nil
+	}
+	cached, ok := p.c.Get(p.cacheKey(obj.Namespace(), key))
+	if !ok {
+		return false, nil
+	}
+	if err := p.unmarshal(obj.Namespace(), cached.(string), obj); err != nil {
+		return false, err
+	}
+	p.stats.record(SourceLocal, nil)
+	return true, nil
+}
+
+// GetWithStale works like Get and also reports whether obj was filled with a stale copy
+// because the data loader failed, which only happens when ServeStaleOnError is enabled.
+func (p *LevelCache) GetWithStale(ctx context.Context, key string, obj Cacheable) (bool, error) {
+	if err := checkObject(obj, true); err != nil {
+		return false, err
+	}
+	p.checkCacheUpdate(ctx, obj.Namespace(), key)
+	src, err := p.get(ctx, key, obj, getOptions{})
+	return src == SourceStale, err
+}
+
+// GetWithTTL works like Get and also returns the remaining time to live of the value,
+// taken from the local entry when it served the value and from redis otherwise.
+// NoExpiration is returned for values that never expire and zero for stale values.
+func (p *LevelCache) GetWithTTL(ctx context.Context, key string, obj Cacheable) (time.Duration, error) {
+	if err := checkObject(obj, true); err != nil {
+		return 0, err
+	}
+	p.checkCacheUpdate(ctx, obj.Namespace(), key)
+	src, err := p.get(ctx, key, obj, getOptions{})
+	if err != nil {
+		return 0, err
+	}
+	k := p.cacheKey(obj.Namespace(), key)
+	if src == SourceStale {
+		return 0, nil
+	}
+	if src == SourceLocal || p.localOnly() {
+		if _, expiration, ok := p.c.GetWithExpiration(k); ok {
+			if expiration.IsZero() {
+				return NoExpiration, nil
+			}
+			return time.Until(expiration), nil
 		}
-		return nil
 	}
+	if p.localOnly() {
+		return 0, ErrRedisDisabled
+	}
+	// the values of a HashStorage namespace live as long as their hash
+	sk, _ := p.storageKey(obj.Namespace(), key)
+	ttl, err := p.rdb.PTTL(ctx, sk).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		// -1 means no expiration and -2 a key already gone
+		if ttl == NoExpiration {
+			return NoExpiration, nil
+		}
+		return 0, nil
+	}
+	return ttl, nil
+}
 
-	// read redis cache
-	content, err := p.rdb.Get(ctx, k).Result()
+// GetIfChanged fills obj only when the version of key moved past sinceVersion,
+// an unchanged version returns false without reading or decoding the value.
+func (p *LevelCache) GetIfChanged(ctx context.Context, namespace, key string, sinceVersion int64, obj Cacheable) (bool, error) {
+	if err := checkObject(obj, true); err != nil {
+		return false, err
+	}
+	if obj.Namespace() != namespace {
+		return false, fmt.Errorf("%w: get [%s] object from [%s]", ErrNamespaceMismatch, obj.Namespace(), namespace)
+	}
+	if p.versioningDisabled(namespace) {
+		return false, ErrVersioningDisabled
+	}
+	current, err := p.currentVersion(ctx, namespace, key)
+	if err != nil {
+		return false, err
+	}
+	if current == sinceVersion {
+		return false, nil
+	}
+	k := p.cacheKey(namespace, key)
+	if local, ok := p.getVersion(k); ok && local != current {
+		// the local copy is behind, read through to redis
+		p.c.Delete(k)
+		p.invalidated(EventInvalidate, namespace, key)
+	}
+	src, err := p.get(ctx, key, obj, getOptions{})
+	if err != nil {
+		return false, err
+	}
+	if src == SourceRedis {
+		p.setVersion(k, current)
+	}
+	return true, nil
+}
+
+// Inspect returns the raw values stored for key in the local cache and in redis along with its current version,
+// empty strings stand for a level without the key.
+func (p *LevelCache) Inspect(ctx context.Context, namespace, key string) (local string, remote string, version int64, err error) {
+	k := p.cacheKey(namespace, key)
+	if content, ok := p.c.Get(k); ok {
+		local = content.(string)
+	}
+	if p.localOnly() {
+		return local, "", 0, ErrRedisDisabled
+	}
+	remote, err = p.getEntry(ctx, p.rdb, namespace, key).Result()
 	if err != nil && err != redis.Nil {
-		return err
+		return local, "", 0, err
 	}
-	if content != "" {
-		if err := jsoniter.UnmarshalFromString(content, obj); err != nil {
-			return err
+	version, err = p.currentVersion(ctx, namespace, key)
+	return local, remote, version, err
+}
+
+func (p *LevelCache) get(ctx context.Context, key string, obj Cacheable, o getOptions) (src Source, err error) {
+	defer func() {
+		p.stats.record(src, err)
+	}()
+	if err := p.checkType(obj.Namespace(), obj); err != nil {
+		return SourceNone, err
+	}
+	k := p.cacheKey(obj.Namespace(), key)
+	nscfg := p.namespaceConfig(obj.Namespace())
+	// the values of a namespace ReloadNamespace is removing are loaded without reading or writing either level
+	reloading := p.reloading(obj.Namespace())
+	local := !nscfg.localDisabled && !o.skipLocal && !reloading
+	populate := local && !o.noPopulateLocal
+	// the local copy of an AlwaysReadRedis namespace is only read when there is no redis
+	readLocal := local && !o.forceReload && (!nscfg.alwaysReadRedis || p.localOnly())
+	ttl := o.ttl
+	// read local cache
+	if cached, ok := p.c.Get(k); ok && readLocal {
+		content, err := p.verifyLocal(ctx, obj.Namespace(), key, cached.(string), o.strict)
+		if err != nil {
+			return SourceNone, err
+		}
+		if content != "" {
+			if err := p.unmarshal(obj.Namespace(), content, obj); err != nil {
+				return SourceNone, err
+			}
+			return SourceLocal, nil
 		}
-		p.c.SetDefault(k, toJson(obj))
 	}
 
-	loader, exist := p.loaders[obj.Namespace()]
-	if !exist {
-		return fmt.Errorf("data loader [%s] not found", obj.Namespace())
+	// read redis cache, falling through to the loader when redis is unavailable
+	missed := false
+	if !o.forceReload && !p.localOnly() && !reloading {
+		content, err := p.getRedis(ctx, obj.Namespace(), key)
+		if err != nil && err != redis.Nil {
+			p.cfg.Logger.Printf("read redis [%s] fail, fall through to loader: %v", k, err)
+		}
+		missed = err == nil || err == redis.Nil
+		if content != "" {
+			if err := p.unmarshal(obj.Namespace(), content, obj); err != nil {
+				return SourceNone, err
+			}
+			if populate {
+				p.c.Set(k, content, p.localExpiration(ttl))
+			}
+			return SourceRedis, nil
+		}
 	}
-	data, err := loader(ctx, key)
-	if err != nil {
-		return err
+
+	if o.cachedOnly {
+		return SourceNone, nil
 	}
-	if err := copier.Copy(obj, data); err != nil {
-		return err
+	var (
+		content   string
+		loadedTTL time.Duration
+		loaded    = SourceLoader
+	)
+	if o.seed != nil {
+		loaded = SourceSeed
+		if content, err = p.seed(ctx, key, obj, o.seed); err != nil {
+			return p.getDefault(ctx, key, obj, o, err)
+		}
+	} else {
+		negative := p.negatives != nil && local && !o.forceReload
+		if negative && p.negatives.has(k, p.cfg.Clock.Now()) {
+			return p.getDefault(ctx, key, obj, o, fmt.Errorf("data [%s] of [%s] %w, remembered as missing", key, obj.Namespace(), ErrNotFound))
+		}
+		fetch := o.fetch
+		if fetch == nil {
+			loader, exist := p.loader(obj.Namespace())
+			if !exist {
+				return p.getDefault(ctx, key, obj, o, fmt.Errorf("data loader [%s] %w", obj.Namespace(), ErrNotFound))
+			}
+			fetch = func(key string) (Cacheable, time.Duration, error) {
+				return p.load(ctx, obj.Namespace(), key, loader)
+			}
+		}
+		var data Cacheable
+		data, loadedTTL, err = fetch(key)
+		if err != nil {
+			if negative && errors.Is(err, ErrNotFound) {
+				p.negatives.add(k, p.cfg.Clock.Now())
+			}
+			if o.def != nil && errors.Is(err, ErrNotFound) {
+				return p.getDefault(ctx, key, obj, o, err)
+			}
+			if p.cfg.ServeStaleOnError && p.getStale(ctx, obj.Namespace(), key, obj) {
+				p.cfg.Logger.Printf("%v, serve stale value", err)
+				return SourceStale, nil
+			}
+			return SourceNone, err
+		}
+		// round trip through the serialized form instead of copying fields,
+		// so obj never shares pointers, slices or maps with what the loader returned
+		// and a loaded object of another shape fails instead of leaving fields unset
+		content, err = p.marshal(obj.Namespace(), data)
+		if err != nil {
+			return SourceNone, err
+		}
+		if err := p.unmarshal(obj.Namespace(), content, obj); err != nil {
+			return SourceNone, fmt.Errorf("decode %T loaded for [%s] key [%s] into %T: %w", data, obj.Namespace(), key, obj, err)
+		}
+	}
+	if ttl == 0 {
+		ttl = loadedTTL
+	}
+	if p.checkSize(obj.Namespace(), key, content) != nil {
+		return loaded, nil
+	}
+	switch {
+	case p.localOnly(), p.oversized(obj.Namespace()), reloading:
+		// nothing to write but the local entry, if any
+	case o.forceReload:
+		// a forced reload replaces the value, bump the version so other instances drop their copies
+		if _, err := p.setRedisIfVersion(ctx, obj.Namespace(), key, content, anyVersion, p.redisExpiration(ttl)); err != nil {
+			return SourceNone, err
+		}
+	case !missed:
+		// the read failed, redis may hold a value or not, write this one as is
+		if err := p.setEntry(ctx, p.rdb, obj.Namespace(), key, content, p.redisExpiration(ttl)); err != nil {
+			if err := p.writeError(k, err); err != nil {
+				return SourceNone, err
+			}
+		}
+		p.setStale(ctx, obj.Namespace(), key, content)
+	default:
+		// only written when still missing, a value stored meanwhile by another loader or writer is newer
+		// or as fresh, serving it instead makes the concurrent reads of a cold key converge
+		current, version, err := p.getOrSetEntry(ctx, obj.Namespace(), key, content, p.redisExpiration(ttl))
+		if err != nil {
+			if err := p.writeError(k, err); err != nil {
+				return SourceNone, err
+			}
+		} else {
+			if current != content {
+				if err := p.unmarshal(obj.Namespace(), current, obj); err != nil {
+					return SourceNone, err
+				}
+				content, loaded = current, SourceRedis
+			}
+			if populate && version > 0 {
+				p.raiseVersion(k, version)
+			}
+		}
+		p.setStale(ctx, obj.Namespace(), key, content)
+	}
+	if !populate {
+		return loaded, nil
 	}
-	p.rdb.Set(ctx, k, toJson(obj), p.cfg.CacheExpiration)
-	p.c.SetDefault(k, toJson(obj))
+	p.c.Set(k, content, p.localExpiration(ttl))
+	p.vmu.Lock()
 	if _, ok := p.version[k]; !ok {
 		p.version[k] = 0
 	}
-	return nil
+	p.vmu.Unlock()
+	return loaded, nil
 }
-func (p *levelCache) checkCacheUpdate(ctx context.Context, namespace, key string) {
-	k := jointKey(namespace, key)
-	vk := jointKey(namespace, key, "version")
-	latestContent, err := p.rdb.Get(ctx, vk).Result()
+
+// getDefault fills obj with the WithDefault object of the call when err reports a missing value,
+// caching it for the default TTL when one was given, and returns err otherwise
+func (p *LevelCache) getDefault(ctx context.Context, key string, obj Cacheable, o getOptions, err error) (Source, error) {
+	if o.def == nil || !errors.Is(err, ErrNotFound) {
+		return SourceNone, err
+	}
+	if err := checkNamespace(obj.Namespace(), key, o.def); err != nil {
+		return SourceNone, err
+	}
+	content, err := p.marshal(obj.Namespace(), o.def)
 	if err != nil {
+		return SourceNone, err
+	}
+	if err := p.unmarshal(obj.Namespace(), content, obj); err != nil {
+		return SourceNone, err
+	}
+	if o.defaultTTL <= 0 || p.checkSize(obj.Namespace(), key, content) != nil {
+		return SourceDefault, nil
+	}
+	k := p.cacheKey(obj.Namespace(), key)
+	if !p.localOnly() && !p.oversized(obj.Namespace()) {
+		if err := p.setEntry(ctx, p.rdb, obj.Namespace(), key, content, o.defaultTTL); err != nil {
+			if err := p.writeError(k, err); err != nil {
+				return SourceNone, err
+			}
+		}
+	}
+	if !p.namespaceConfig(obj.Namespace()).localDisabled && !o.skipLocal && !o.noPopulateLocal {
+		p.c.Set(k, content, o.defaultTTL)
+	}
+	return SourceDefault, nil
+}
+
+// writeError applies the WriteErrorPolicy to the failed redis write of a loaded value,
+// returning the error when the read must fail
+func (p *LevelCache) writeError(k string, err error) error {
+	switch p.cfg.WriteErrorPolicy {
+	case WriteErrorIgnore:
+		return nil
+	case WriteErrorReturn:
+		return fmt.Errorf("write redis [%s] fail: %w", k, err)
+	default:
+		p.cfg.Logger.Printf("write redis [%s] fail, serve loaded value: %v", k, err)
+		return nil
+	}
+}
+
+// setStale keeps the last known value past its expiration when ServeStaleOnError is enabled
+func (p *LevelCache) setStale(ctx context.Context, namespace, key, content string) {
+	if p.localOnly() || !p.cfg.ServeStaleOnError {
 		return
 	}
+	p.rdb.Set(ctx, p.cacheKey("stale", namespace, key), content, p.cfg.StaleExpiration)
+}
+
+func (p *LevelCache) getStale(ctx context.Context, namespace, key string, obj Cacheable) bool {
+	if p.localOnly() {
+		return false
+	}
+	content, err := p.reader().Get(ctx, p.cacheKey("stale", namespace, key)).Result()
+	if err == nil {
+		content, err = liveEntry(content)
+	}
+	if err != nil {
+		return false
+	}
+	return p.unmarshal(obj.Namespace(), content, obj) == nil
+}
+func (p *LevelCache) checkCacheUpdate(ctx context.Context, namespace, key string) {
+	if nscfg := p.namespaceConfig(namespace); p.localOnly() || nscfg.localDisabled || nscfg.alwaysReadRedis || p.versioningDisabled(namespace) {
+		return
+	}
+	if b, ok := ctx.Value(batchKey{}).(*Batch); ok && b.cache == p {
+		b.add(namespace, key)
+		return
+	}
+	latest, err := p.reader().Get(ctx, p.versionKey(namespace, key)).Result()
+	if err != nil && err != redis.Nil {
+		p.versionCheckFailed(namespace, key, err)
+		return
+	}
+	p.versionCheckSucceeded()
+	if err == redis.Nil {
+		// never written by Set or Refresh, or expired with its value, there is nothing to compare with
+		return
+	}
+	p.applyVersion(namespace, key, latest)
+}
+
+// versionCheckFailed reports a version read failing on redis, the local entry of key being served unchecked
+func (p *LevelCache) versionCheckFailed(namespace, key string, err error) {
+	p.stats.failVersionCheck()
+	if p.cfg.DegradeOnVersionError {
+		atomic.StoreInt32(&p.degraded, 1)
+	}
+	p.cfg.Logger.Printf("check version [%s] key [%s] fail, local copy served unchecked: %v", namespace, key, err)
+	if p.cfg.Hooks.OnVersionCheckError != nil {
+		p.cfg.Hooks.OnVersionCheckError(namespace, key, err)
+	}
+}
+
+// versionCheckSucceeded leaves the degraded mode entered by versionCheckFailed
+func (p *LevelCache) versionCheckSucceeded() {
+	if p.cfg.DegradeOnVersionError && atomic.LoadInt32(&p.degraded) == 1 {
+		atomic.StoreInt32(&p.degraded, 0)
+	}
+}
+
+// applyVersion queues the update of the local entry of key when latestContent, its version read from redis,
+// differs from the local one
+func (p *LevelCache) applyVersion(namespace, key, latestContent string) {
 	latest, err := strconv.ParseInt(latestContent, 10, 64)
 	if err != nil {
 		return
 	}
-	current, ok := p.version[k]
+	k := p.cacheKey(namespace, key)
+	current, ok := p.getVersion(k)
 	if !ok {
 		return
 	}
 	if latest != current {
-		p.updates <- versionInfo{
+		// never stall the read on a busy worker, a dropped update leaves the local copy stale
+		// until a later read of the key queues it again or the entry expires
+		p.umu.RLock()
+		select {
+		case p.updates <- versionInfo{
 			dataKey:   k,
 			versionNo: latest,
+			namespace: namespace,
+			key:       key,
+		}:
+		default:
+			p.stats.dropUpdate()
 		}
+		p.umu.RUnlock()
 	}
 }
 
-func (p *levelCache) parseAndDo(ctx context.Context, info versionInfo) error {
-	content, err := p.rdb.Get(ctx, info.dataKey).Result()
+func (p *LevelCache) parseAndDo(ctx context.Context, info versionInfo) error {
+	cmd := p.rdb.Get(ctx, info.dataKey)
+	if p.hashStorage(info.namespace) {
+		cmd = p.rdb.HGet(ctx, p.hashKey(info.namespace), info.key)
+	}
+	content, err := cmd.Result()
+	if err == nil {
+		content, err = liveEntry(content)
+	}
 	if err != nil {
 		return err
 	}
-	p.version[info.dataKey] = info.versionNo
+	p.setVersion(info.dataKey, info.versionNo)
 	p.c.SetDefault(info.dataKey, content)
+	p.invalidated(EventInvalidate, info.namespace, info.key)
 	return nil
 }
 
-func (p *levelCache) Refresh(ctx context.Context, namespace, key string) {
-	loader, exist := p.loaders[namespace]
+// RefreshHandle tracks a refresh running in the background
+type RefreshHandle struct {
+	done    chan struct{}
+	err     error
+	started time.Time
+}
+
+// Wait blocks until the refresh finished and returns its error, or until ctx is done.
+// A nil handle has nothing to wait for.
+func (h *RefreshHandle) Wait(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+	select {
+	case <-h.done:
+		return h.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Refresh reloads key in the background, the returned handle waits for it and may be ignored.
+// The loader receives the values of ctx but the refresh outlives its cancellation and deadline,
+// it is bounded by RedisOpTimeout instead. Failures are also reported to the Logger.
+func (p *LevelCache) Refresh(ctx context.Context, namespace, key string) *RefreshHandle {
+	loader, exist := p.loader(namespace)
 	if !exist {
-		return
+		h := &RefreshHandle{done: make(chan struct{})}
+		h.err = fmt.Errorf("data loader [%s] %w", namespace, ErrNotFound)
+		close(h.done)
+		return h
+	}
+	h, started := p.debounce(namespace, key)
+	if !started {
+		return h
 	}
 	go func() {
-		k := jointKey(namespace, key)
-		lockKey := jointKey("lock", k)
-		vk := jointKey("version", k)
-		for {
-			lock, err := p.locker.Obtain(ctx, lockKey, p.cfg.LockInterval, nil)
-			if err != nil {
-				time.Sleep(time.Millisecond)
-				continue
-			}
-			data, err := loader(ctx, key)
+		ctx, cancel := p.backgroundContext(detachedContext{parent: ctx})
+		defer cancel()
+		h.err = p.refresh(ctx, namespace, key, func() (Cacheable, time.Duration, error) {
+			return p.load(ctx, namespace, key, loader)
+		})
+		if h.err != nil {
+			p.cfg.Logger.Printf("refresh [%s] key [%s] fail: %v", namespace, key, h.err)
+		}
+		p.settle(namespace, key, h)
+	}()
+	return h
+}
+
+// RefreshMany reloads and rewrites every key of the namespace, bumping each version.
+// At most RefreshConcurrency keys are reloaded at once and each key is guarded by its own lock,
+// the keys which failed are reported by a MultiError while the others are still written. The reloaded values are written to redis in a single pipeline
+// once every key was loaded, the locks being held until then.
+// When a BatchDataLoader is registered all keys are fetched with a single call to it,
+// keys missing from its result are reported as not found and left untouched.
+func (p *LevelCache) RefreshMany(ctx context.Context, namespace string, keys []string) error {
+	fetch, err := p.fetcher(ctx, namespace, keys)
+	if err != nil {
+		return err
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   = make(map[string]error)
+		writes []refreshWrite
+		sem    = make(chan struct{}, p.cfg.RefreshConcurrency)
+	)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			w, err := p.reload(ctx, namespace, key, func() (Cacheable, time.Duration, error) {
+				return fetch(key)
+			})
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
+				errs[key] = err
 				return
 			}
-			p.c.SetDefault(k, toJson(data))
-			p.rdb.Set(ctx, k, toJson(data), p.cfg.CacheExpiration)
+			writes = append(writes, w)
+		}(key)
+	}
+	wg.Wait()
+	for key, err := range p.setRedisMany(ctx, namespace, writes) {
+		errs[key] = err
+	}
+	for _, w := range writes {
+		if _, failed := errs[w.key]; !failed {
+			p.emit(EventRefresh, namespace, w.key)
+		}
+	}
+	return multiError(fmt.Sprintf("refresh [%s]", namespace), errs)
+}
 
-			if recNo, err := p.rdb.Incr(ctx, vk).Result(); err == nil {
-				p.version[k] = recNo
+// fetcher returns a per key fetch function for keys, backed by one batch load when possible
+func (p *LevelCache) fetcher(ctx context.Context, namespace string, keys []string) (func(key string) (Cacheable, time.Duration, error), error) {
+	if batch, exist := p.batchLoader(namespace); exist {
+		data, err := p.callBatchLoader(ctx, namespace, keys, batch)
+		if err != nil {
+			return nil, LoaderError{Namespace: namespace, Err: err}
+		}
+		return func(key string) (Cacheable, time.Duration, error) {
+			if obj, ok := data[key]; ok && obj != nil {
+				if err := checkNamespace(namespace, key, obj); err != nil {
+					return nil, 0, err
+				}
+				if err := p.checkType(namespace, obj); err != nil {
+					return nil, 0, err
+				}
+				return obj, 0, p.validate(namespace, key, obj)
 			}
-			_ = lock.Release(ctx)
-			break
+			return nil, 0, LoaderError{Namespace: namespace, Key: key, Err: fmt.Errorf("data [%s] of [%s] %w by batch loader", key, namespace, ErrNotFound)}
+		}, nil
+	}
+	loader, exist := p.loader(namespace)
+	if !exist {
+		return nil, fmt.Errorf("data loader [%s] %w", namespace, ErrNotFound)
+	}
+	return func(key string) (Cacheable, time.Duration, error) {
+		return p.load(ctx, namespace, key, loader)
+	}, nil
+}
+
+func (p *LevelCache) refresh(ctx context.Context, namespace, key string, load func() (Cacheable, time.Duration, error)) error {
+	w, err := p.reload(ctx, namespace, key, load)
+	if err != nil {
+		return err
+	}
+	defer w.release(ctx)
+	if err := p.setRedis(ctx, namespace, key, w.content, w.ttl); err != nil {
+		return err
+	}
+	p.emit(EventRefresh, namespace, key)
+	return nil
+}
+
+// refreshWrite is a value reloaded by reload waiting for its redis write, under the reload lock of its key
+type refreshWrite struct {
+	key     string
+	content string
+	ttl     time.Duration
+	lock    *redislock.Lock
+}
+
+// release frees the lock even once ctx is done, e.g. when the reload ran out of RedisOpTimeout,
+// so that the next reload of the key does not wait for the lock to expire
+func (w refreshWrite) release(ctx context.Context) {
+	if w.lock != nil {
+		_ = w.lock.Release(detachedContext{parent: ctx})
+	}
+}
+
+// reload takes the reload lock of key, loads it and writes it to the local cache.
+// The caller writes it to redis and releases the lock, there is no lock for a cache created by NewLocalOnly.
+func (p *LevelCache) reload(ctx context.Context, namespace, key string, load func() (Cacheable, time.Duration, error)) (refreshWrite, error) {
+	w := refreshWrite{key: key}
+	if !p.localOnly() {
+		lock, err := p.obtainLock(ctx, namespace, key)
+		if err != nil {
+			return w, err
 		}
-	}()
+		w.lock = lock
+	}
+	data, ttl, err := load()
+	if err == nil {
+		w.content, err = p.marshal(namespace, data)
+	}
+	if err == nil {
+		err = p.checkSize(namespace, key, w.content)
+	}
+	if err != nil {
+		w.release(ctx)
+		return w, err
+	}
+	w.ttl = ttl
+	p.setLocal(namespace, key, w.content, ttl)
+	return w, nil
+}
+
+// versionKey is the redis key counting the writes of key in namespace
+func (p *LevelCache) versionKey(namespace, key string) string {
+	return p.cacheKey("version", namespace, key)
+}
+
+// DataKey returns the redis key holding the value of key in namespace, as built by the KeyEncoder,
+// for tools reading the cache from outside. The local cache uses the same key,
+// the values of a namespace with HashStorage are rather the key field of the hash named after the namespace.
+func (p *LevelCache) DataKey(namespace, key string) string {
+	return p.cacheKey(namespace, key)
+}
+
+// VersionKey returns the redis key counting the writes of key in namespace, as built by the KeyEncoder.
+func (p *LevelCache) VersionKey(namespace, key string) string {
+	return p.versionKey(namespace, key)
+}
+
+// currentVersion reads the version of key from redis, zero when it was never written
+func (p *LevelCache) currentVersion(ctx context.Context, namespace, key string) (int64, error) {
+	if p.localOnly() {
+		return 0, ErrRedisDisabled
+	}
+	v, err := p.reader().Get(ctx, p.versionKey(namespace, key)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// historyKey is the redis list of the values replaced in key of namespace, newest first
+func (p *LevelCache) historyKey(namespace, key string) string {
+	return p.cacheKey("history", namespace, key)
+}
+
+// History returns up to limit values replaced in key of namespace by Set and Refresh, newest first,
+// all the kept ones when limit is not positive. Only HistoryDepth values are kept.
+func (p *LevelCache) History(ctx context.Context, namespace, key string, limit int) ([]string, error) {
+	if p.localOnly() {
+		return nil, ErrRedisDisabled
+	}
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+	entries, err := p.reader().LRange(ctx, p.historyKey(namespace, key), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if entries[i], err = decodeEntry(entry, p.cfg.Encryptor); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// lockKey is the redis key of the lock guarding a reload of key in namespace,
+// namespace and key stay separate parts so that different namespaces never share a lock.
+func (p *LevelCache) lockKey(namespace, key string) string {
+	return p.cacheKey("lock", namespace, key)
+}
+
+// checkSize returns ErrValueTooLarge and logs it when content exceeds MaxValueBytes
+func (p *LevelCache) checkSize(namespace, key, content string) error {
+	if p.cfg.MaxValueBytes <= 0 || len(content) <= p.cfg.MaxValueBytes {
+		return nil
+	}
+	p.cfg.Logger.Printf("value [%s] key [%s] of %d bytes exceeds %d, not cached", namespace, key, len(content), p.cfg.MaxValueBytes)
+	return fmt.Errorf("value [%s] of [%s] is %d bytes: %w", key, namespace, len(content), ErrValueTooLarge)
+}
+
+// localExpiration is ttl, or LocalExpiration when ttl is zero
+func (p *LevelCache) localExpiration(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return p.cfg.LocalExpiration
+	}
+	return ttl
+}
+
+// redisExpiration is ttl, or RedisExpiration when ttl is zero
+func (p *LevelCache) redisExpiration(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		return p.cfg.RedisExpiration
+	}
+	return ttl
+}
+
+// setLocal writes the serialized value to the local cache unless the namespace disabled it,
+// a zero ttl stands for LocalExpiration
+func (p *LevelCache) setLocal(namespace, key, content string, ttl time.Duration) {
+	if p.namespaceConfig(namespace).localDisabled {
+		return
+	}
+	k := p.cacheKey(namespace, key)
+	p.c.Set(k, content, p.localExpiration(ttl))
+	if p.negatives != nil {
+		p.negatives.delete(k)
+	}
+}
+
+// setRedis writes the serialized value to redis and bumps its version in one atomic step,
+// a zero ttl stands for RedisExpiration
+func (p *LevelCache) setRedis(ctx context.Context, namespace, key, content string, ttl time.Duration) error {
+	if p.localOnly() || p.oversized(namespace) {
+		return nil
+	}
+	_, err := p.setRedisIfVersion(ctx, namespace, key, content, anyVersion, p.redisExpiration(ttl))
+	return err
+}
+
+// setRedisIfVersion is setRedis guarded by the current version, returning the new version
+// or zero when the current version differs from expected or the namespace has no versions
+func (p *LevelCache) setRedisIfVersion(ctx context.Context, namespace, key, content string, expected int64, ttl time.Duration) (int64, error) {
+	if p.localOnly() {
+		return 0, ErrRedisDisabled
+	}
+	if p.oversized(namespace) {
+		return 0, fmt.Errorf("write [%s] key [%s]: %w", namespace, key, ErrRedisWritesSuspended)
+	}
+	k := p.cacheKey(namespace, key)
+	versioned := !p.versioningDisabled(namespace)
+	if !versioned && expected != anyVersion {
+		return 0, ErrVersioningDisabled
+	}
+	var (
+		recNo int64
+		err   error
+	)
+	if !versioned && p.cfg.HistoryDepth <= 0 {
+		err = p.setEntry(ctx, p.rdb, namespace, key, content, ttl)
+	} else {
+		sk, field := p.storageKey(namespace, key)
+		recNo, err = setScript.Run(ctx, p.rdb, []string{sk, p.versionKey(namespace, key), p.historyKey(namespace, key)},
+			content, ttl.Milliseconds(), expected, p.cfg.HistoryDepth, versioned, versionGrace.Milliseconds(), field).Int64()
+	}
+	if err != nil || (versioned && recNo == 0) {
+		return 0, err
+	}
+	p.setStale(ctx, namespace, key, content)
+	if versioned && !p.namespaceConfig(namespace).localDisabled {
+		p.raiseVersion(k, recNo)
+	}
+	return recNo, nil
+}
+
+func (p *LevelCache) getVersion(k string) (int64, bool) {
+	p.vmu.RLock()
+	defer p.vmu.RUnlock()
+	v, ok := p.version[k]
+	return v, ok
+}
+
+func (p *LevelCache) setVersion(k string, v int64) {
+	p.vmu.Lock()
+	p.version[k] = v
+	p.vmu.Unlock()
 }
 
+// raiseVersion records v unless a newer version was already recorded by a concurrent write
+func (p *LevelCache) raiseVersion(k string, v int64) {
+	p.vmu.Lock()
+	if current, ok := p.version[k]; !ok || current < v {
+		p.version[k] = v
+	}
+	p.vmu.Unlock()
+}
+
+func (p *LevelCache) cacheKey(a ...string) string {
+	k := p.cfg.KeyEncoder.Encode(a...)
+	if p.cfg.MaxKeyLength > 0 && len(k) > p.cfg.MaxKeyLength {
+		return p.hashedKey(k, a)
+	}
+	return k
+}
+
+// globEscaper escapes the characters redis glob patterns give a meaning to
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// namespacePattern is the redis glob pattern matching the keys of the values of namespace stored as strings,
+// the namespace matching only itself whatever the characters it contains
+func (p *LevelCache) namespacePattern(namespace string) string {
+	return globEscaper.Replace(p.cfg.KeyEncoder.Encode(namespace, "")) + "*"
+}
+
+// jointKey joins the parts with cacheKeyJoint, escaping backslashes and '#' inside each part
+// so that parts containing the joint can never collide with another combination.
+// Parts without those characters are kept as they are.
 func jointKey(a ...string) string {
-	return strings.Join(a, cacheKeyJoint)
+	return defaultJointEncoder.Encode(a...)
+}
+
+// splitJointKey reverses jointKey, it reports false for keys jointKey cannot have built
+func splitJointKey(k string) ([]string, bool) {
+	return defaultJointEncoder.split(k)
+}
+
+// jointEncoder is the default KeyEncoder, unlike custom ones its keys can be split back into their parts.
+// It joins the parts with its separator, escaping backslashes and the first byte of the separator inside each part.
+type jointEncoder struct {
+	separator string
+	escaper   *strings.Replacer
+}
+
+func newJointEncoder(separator string) jointEncoder {
+	first := separator[:1]
+	return jointEncoder{
+		separator: separator,
+		escaper:   strings.NewReplacer(`\`, `\\`, first, `\`+first),
+	}
+}
+
+func (e jointEncoder) Encode(a ...string) string {
+	parts := make([]string, len(a))
+	for i, part := range a {
+		parts[i] = e.escaper.Replace(part)
+	}
+	return strings.Join(parts, e.separator)
+}
+
+func (e jointEncoder) split(k string) ([]string, bool) {
+	var (
+		parts []string
+		part  strings.Builder
+	)
+	for i := 0; i < len(k); i++ {
+		switch {
+		case k[i] == '\\' && i+1 < len(k):
+			i++
+			part.WriteByte(k[i])
+		case strings.HasPrefix(k[i:], e.separator):
+			parts = append(parts, part.String())
+			part.Reset()
+			i += len(e.separator) - 1
+		case k[i] == '\\' || k[i] == e.separator[0]:
+			return nil, false
+		default:
+			part.WriteByte(k[i])
+		}
+	}
+	return append(parts, part.String()), true
+}
+
+// checkObject returns ErrNilObject for a nil obj, or one which is not a pointer when it is the target of a Get
+func checkObject(obj Cacheable, target bool) error {
+	if obj == nil {
+		return fmt.Errorf("%w: nil Cacheable", ErrNilObject)
+	}
+	v := reflect.ValueOf(obj)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return fmt.Errorf("%w: nil %T", ErrNilObject, obj)
+		}
+	}
+	if target && v.Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: %T is not a pointer", ErrNilObject, obj)
+	}
+	return nil
+}
+
+// checkNamespace makes sure a loader of namespace produced an object of the same namespace
+func checkNamespace(namespace, key string, data Cacheable) error {
+	if data != nil && data.Namespace() != namespace {
+		return fmt.Errorf("%w: loader of [%s] returned [%s] object for key [%s]", ErrNamespaceMismatch, namespace, data.Namespace(), key)
+	}
+	return nil
+}
+
+// redisTTL converts a cache expiration to the one of redis SET, where -1 would mean KEEPTTL
+func redisTTL(ttl time.Duration) time.Duration {
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
 }
 
 func toJson(obj interface{}) string {
-	content, err := jsoniter.MarshalToString(obj)
+	content, err := stableJSON.MarshalToString(obj)
 	if err != nil {
 		return ""
 	}
@@ -2,8 +2,19 @@ package levelcache
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLevelCache_Get(t *testing.T) {
@@ -56,3 +67,1092 @@ func TestLevelCache_Refresh(t *testing.T) {
 	}
 	t.Logf("hot dish:%+v", dish)
 }
+
+func TestLevelCache_RefreshWait(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	name := "before"
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 47, Name: name}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "47"))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "47", &dish))
+	assert.Equal(t, "before", dish.Name)
+	name = "after"
+	assert.Nil(t, cache.Refresh(context.TODO(), "dish", "47").Wait(context.TODO()))
+	assert.Nil(t, cache.Get(context.TODO(), "47", &dish))
+	assert.Equal(t, "after", dish.Name)
+
+	err = cache.Refresh(context.TODO(), "drink", "47").Wait(context.TODO())
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestLevelCache_RefreshDebounce(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		RefreshDebounce: time.Minute,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var loads int32
+	loader := func(ctx context.Context, key string) (Cacheable, error) {
+		atomic.AddInt32(&loads, 1)
+		return GetDish(ctx, key)
+	}
+	_ = cache.RegisterLoader("dish", loader)
+
+	handles := make([]*RefreshHandle, 50)
+	for i := range handles {
+		handles[i] = cache.Refresh(context.TODO(), "dish", "1")
+	}
+	for _, h := range handles {
+		assert.Nil(t, h.Wait(context.TODO()))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	// a refresh once the previous one completed reloads
+	assert.Nil(t, cache.Refresh(context.TODO(), "dish", "1").Wait(context.TODO()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	// without a window every refresh reloads
+	undebounced, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = undebounced.RegisterLoader("dish", loader)
+	assert.Nil(t, undebounced.Refresh(context.TODO(), "dish", "1").Wait(context.TODO()))
+	assert.Nil(t, undebounced.Refresh(context.TODO(), "dish", "1").Wait(context.TODO()))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads))
+}
+
+func TestLevelCache_RefreshDebounceWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		RefreshDebounce: time.Second,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var (
+		loads   int32
+		loading = make(chan struct{})
+		release = make(chan struct{})
+	)
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			close(loading)
+			<-release
+		}
+		return &Dish{ID: 103}, nil
+	})
+	ctx := context.TODO()
+	running := cache.Refresh(ctx, "dish", "103")
+	<-loading
+	assert.Equal(t, running, cache.Refresh(ctx, "dish", "103"))
+	// a refresh running for longer than the window is not joined any more
+	clock.Advance(2 * time.Second)
+	refreshed := cache.Refresh(ctx, "dish", "103")
+	assert.NotEqual(t, running, refreshed)
+	close(release)
+	assert.Nil(t, running.Wait(ctx))
+	assert.Nil(t, refreshed.Wait(ctx))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+}
+
+func TestLevelCache_RefreshWhileRefreshing(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var (
+		mu      sync.Mutex
+		source  = "before"
+		loads   int32
+		loading = make(chan struct{})
+		release = make(chan struct{})
+	)
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		mu.Lock()
+		name := source
+		mu.Unlock()
+		if atomic.AddInt32(&loads, 1) == 1 {
+			// the first reload read the source before the update and is still running
+			close(loading)
+			<-release
+		}
+		return &Dish{ID: 96, Name: name}, nil
+	})
+	ctx := context.TODO()
+	running := cache.Refresh(ctx, "dish", "96")
+	<-loading
+	mu.Lock()
+	source = "after"
+	mu.Unlock()
+	refreshed := cache.Refresh(ctx, "dish", "96")
+	assert.NotEqual(t, running, refreshed)
+	close(release)
+	assert.Nil(t, running.Wait(ctx))
+	assert.Nil(t, refreshed.Wait(ctx))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "96", &dish, SkipLocal()))
+	assert.Equal(t, "after", dish.Name)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+}
+
+type bulkDish struct {
+	Dish
+}
+
+func (p *bulkDish) Namespace() string {
+	return "bulkDish"
+}
+
+func getBulkDish(ctx context.Context, key string) (Cacheable, error) {
+	dish, err := GetDish(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &bulkDish{Dish: *dish.(*Dish)}, nil
+}
+
+func TestLevelCache_RefreshMany(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	// keys no other test writes, so that only RefreshMany bumps their versions
+	_ = cache.RegisterLoader("bulkDish", func(ctx context.Context, key string) (Cacheable, error) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("dish [%s] %w", key, ErrNotFound)
+		}
+		return &bulkDish{Dish: Dish{ID: id, Name: "bulk"}}, nil
+	})
+	cache.Start(context.Background())
+
+	keys := []string{"104", "105"}
+	before := make(map[string]int64)
+	for _, key := range keys {
+		before[key], _ = cache.rdb.Get(context.TODO(), cache.versionKey("bulkDish", key)).Int64()
+	}
+	if err := cache.RefreshMany(context.TODO(), "bulkDish", keys); err != nil {
+		t.Errorf("refresh many fail:%+v", err)
+		return
+	}
+	for _, key := range keys {
+		after, err := cache.rdb.Get(context.TODO(), cache.versionKey("bulkDish", key)).Int64()
+		assert.Nil(t, err)
+		assert.Equal(t, before[key]+1, after)
+		current, ok := cache.getVersion(jointKey("bulkDish", key))
+		assert.True(t, ok)
+		assert.Equal(t, after, current)
+
+		content, err := cache.rdb.Get(context.TODO(), jointKey("bulkDish", key)).Result()
+		assert.Nil(t, err)
+		local, ok := cache.c.Get(jointKey("bulkDish", key))
+		assert.True(t, ok)
+		assert.Equal(t, content, local)
+	}
+
+	assert.NotNil(t, cache.RefreshMany(context.TODO(), "bulkDish", []string{"104", "missing"}))
+}
+
+func TestLevelCache_RefreshManyPipeline(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		id, _ := strconv.Atoi(key)
+		return &Dish{ID: id, Name: "bulk"}, nil
+	})
+	keys := make([]string, 20)
+	before := make([]int64, len(keys))
+	for i := range keys {
+		keys[i] = strconv.Itoa(100 + i)
+		before[i], _ = cache.rdb.Get(context.TODO(), cache.versionKey("dish", keys[i])).Int64()
+	}
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	assert.Nil(t, cache.RefreshMany(context.TODO(), "dish", keys))
+	// the script load and one write per key
+	assert.Equal(t, []string{"21"}, counter.commands["pipeline"])
+	assert.NotContains(t, counter.commands["evalsha"], setScript.Hash())
+	for i, key := range keys {
+		after, err := cache.rdb.Get(context.TODO(), cache.versionKey("dish", key)).Int64()
+		assert.Nil(t, err)
+		assert.Equal(t, before[i]+1, after)
+		current, _ := cache.getVersion(cache.cacheKey("dish", key))
+		assert.Equal(t, after, current)
+		content, _ := cache.rdb.Get(context.TODO(), cache.cacheKey("dish", key)).Result()
+		assert.Equal(t, toJson(&Dish{ID: 100 + i, Name: "bulk"}), content)
+	}
+}
+
+func benchmarkRefresh(b *testing.B, refresh func(cache *LevelCache, keys []string)) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		b.Fatalf("init cache fail:%+v", err)
+	}
+	_ = cache.RegisterLoader("bulkDish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &bulkDish{Dish{Name: key}}, nil
+	})
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		refresh(cache, keys)
+	}
+}
+
+func BenchmarkLevelCache_RefreshMany(b *testing.B) {
+	benchmarkRefresh(b, func(cache *LevelCache, keys []string) {
+		_ = cache.RefreshMany(context.TODO(), "bulkDish", keys)
+	})
+}
+
+func BenchmarkLevelCache_RefreshEach(b *testing.B) {
+	benchmarkRefresh(b, func(cache *LevelCache, keys []string) {
+		for _, key := range keys {
+			_ = cache.refresh(context.TODO(), "bulkDish", key, func() (Cacheable, time.Duration, error) {
+				return &bulkDish{Dish{Name: key}}, 0, nil
+			})
+		}
+	})
+}
+
+func TestJointKey(t *testing.T) {
+	assert.Equal(t, "dish#$#1", jointKey("dish", "1"))
+	assert.NotEqual(t, jointKey("dish", "1#$#2"), jointKey("dish#$#1", "2"))
+	assert.NotEqual(t, jointKey(`dish\`, "#1"), jointKey(`dish\#`, "1"))
+}
+
+func TestLevelCache_KeyEncoder(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: len(key), Name: key}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "1#$#2"), cache.cacheKey("dish", "1"))
+
+	var collided, plain Dish
+	if err := cache.Get(context.TODO(), "1#$#2", &collided); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	if err := cache.Get(context.TODO(), "1", &plain); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.Equal(t, "1#$#2", collided.Name)
+	assert.Equal(t, "1", plain.Name)
+	assert.NotEqual(t, cache.cacheKey("dish", "1#$#2"), cache.cacheKey("dish#$#1", "2"))
+
+	hashed, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		KeyEncoder: KeyEncoderFunc(func(parts ...string) string {
+			sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+			return hex.EncodeToString(sum[:])
+		}),
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Len(t, hashed.cacheKey("dish", "1#$#2"), 64)
+	assert.NotEqual(t, hashed.cacheKey("dish", "1#$#2"), hashed.cacheKey("dish#$#1", "2"))
+}
+
+func TestLevelCache_KeySeparator(t *testing.T) {
+	_, err := New(CacheConfig{RedisAddr: "localhost:6379", KeySeparator: `\`})
+	assert.NotNil(t, err)
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		KeySeparator:  ":",
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	assert.Equal(t, "dish:46", cache.DataKey("dish", "46"))
+	assert.Equal(t, "version:dish:46", cache.VersionKey("dish", "46"))
+	assert.Equal(t, "lock:dish:46", cache.lockKey("dish", "46"))
+	assert.Equal(t, `dish:a\:b`, cache.DataKey("dish", "a:b"))
+	split, ok := cache.cfg.KeyEncoder.(jointEncoder).split(cache.DataKey("dish", "a:b"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"dish", "a:b"}, split)
+
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 46}))
+	assert.Nil(t, cache.rdb.Get(ctx, "dish:46").Err())
+	assert.Nil(t, cache.rdb.Get(ctx, "version:dish:46").Err())
+	removed, err := cache.DeleteByPattern(ctx, "dish:46")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, redis.Nil, cache.rdb.Get(ctx, "version:dish:46").Err())
+}
+
+// tenantDish is keyed by its tenant and id, Key concatenates them the way callers used to
+type tenantDish struct {
+	Tenant string `json:"tenant"`
+	ID     string `json:"id"`
+}
+
+func (p *tenantDish) Namespace() string {
+	return "tenant_dish"
+}
+
+func (p *tenantDish) Key() string {
+	return p.Tenant + p.ID
+}
+
+func (p *tenantDish) KeyParts() []string {
+	return []string{p.Tenant, p.ID}
+}
+
+func TestLevelCache_KeyParts(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	for _, key := range []string{JoinKey("t1", "5"), JoinKey("t", "15"), "t15"} {
+		cache.rdb.Del(ctx, cache.DataKey("tenant_dish", key))
+	}
+	assert.Nil(t, cache.Set(ctx, &tenantDish{Tenant: "t1", ID: "5"}))
+	assert.Nil(t, cache.Set(ctx, &tenantDish{Tenant: "t", ID: "15"}))
+	assert.Equal(t, "t15", (&tenantDish{Tenant: "t1", ID: "5"}).Key())
+
+	var dish tenantDish
+	assert.Nil(t, cache.Get(ctx, JoinKey("t1", "5"), &dish, SkipLocal()))
+	assert.Equal(t, tenantDish{Tenant: "t1", ID: "5"}, dish)
+	assert.Nil(t, cache.Get(ctx, JoinKey("t", "15"), &dish, SkipLocal()))
+	assert.Equal(t, tenantDish{Tenant: "t", ID: "15"}, dish)
+	// the concatenated key is none of them
+	assert.True(t, errors.Is(cache.Get(ctx, "t15", &dish), ErrNotFound))
+	assert.NotEqual(t, JoinKey("t1#$#5"), JoinKey("t1", "5"))
+}
+
+func TestLevelCache_DataKey(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		KeyEncoder: KeyEncoderFunc(func(parts ...string) string {
+			return "app:" + jointKey(parts...)
+		}),
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	assert.Equal(t, "app:dish#$#1", cache.DataKey("dish", "1"))
+	assert.Equal(t, "app:version#$#dish#$#1", cache.VersionKey("dish", "1"))
+
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.rdb.Del(ctx, cache.DataKey("dish", "1"), cache.VersionKey("dish", "1"))
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "1", &dish))
+	content, err := cache.rdb.Get(ctx, cache.DataKey("dish", "1")).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, toJson(&dish), content)
+	_, ok := cache.c.Get(cache.DataKey("dish", "1"))
+	assert.True(t, ok)
+
+	assert.Nil(t, cache.refresh(ctx, "dish", "1", func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 1, Name: "refreshed"}, 0, nil
+	}))
+	content, _ = cache.rdb.Get(ctx, cache.DataKey("dish", "1")).Result()
+	assert.Equal(t, toJson(&Dish{ID: 1, Name: "refreshed"}), content)
+	version, err := cache.rdb.Get(ctx, cache.VersionKey("dish", "1")).Int64()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), version)
+}
+
+func TestLevelCache_Close(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		cache, err := New(CacheConfig{
+			RedisAddr:     "localhost:6379",
+			RedisPoolSize: 10,
+		})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		cache.Start(context.Background())
+		assert.Nil(t, cache.Close())
+		assert.Nil(t, cache.Close())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline)
+}
+
+func TestLevelCache_StartStop(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+
+	// stopping a cache never started does nothing
+	cache.Stop()
+	cache.Stop()
+	assert.Nil(t, cache.Start(context.Background()))
+	assert.True(t, errors.Is(cache.Start(context.Background()), ErrAlreadyStarted))
+	assert.True(t, cache.Health(context.TODO()).WorkerRunning)
+
+	cache.Stop()
+	cache.Stop()
+	assert.False(t, cache.Health(context.TODO()).WorkerRunning)
+	assert.True(t, errors.Is(cache.Start(context.Background()), ErrAlreadyStarted))
+	// reads queuing version updates keep working once stopped
+	var dish Dish
+	for i := 0; i < 2*defaultMaxUpdateBuffer; i++ {
+		assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	}
+	assert.Nil(t, cache.Close())
+}
+
+func TestLevelCache_ServeStaleOnError(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:         "localhost:6379",
+		RedisPoolSize:     10,
+		ServeStaleOnError: true,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	fail := false
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if fail {
+			return nil, fmt.Errorf("dish store down")
+		}
+		return GetDish(ctx, key)
+	})
+	k := cache.cacheKey("dish", "1")
+	cache.rdb.Del(context.TODO(), k)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "2"), cache.cacheKey("stale", "dish", "2"))
+
+	var primed Dish
+	if err := cache.Get(context.TODO(), "1", &primed); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+
+	// expire both levels, then break the loader
+	cache.rdb.Del(context.TODO(), k)
+	cache.c.Delete(k)
+	fail = true
+
+	var dish Dish
+	stale, err := cache.GetWithStale(context.TODO(), "1", &dish)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, primed, dish)
+
+	var missing Dish
+	stale, err = cache.GetWithStale(context.TODO(), "2", &missing)
+	assert.NotNil(t, err)
+	assert.False(t, stale)
+}
+
+func TestLevelCache_BatchLoader(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		t.Errorf("single loader called for [%s]", key)
+		return GetDish(ctx, key)
+	})
+	var calls [][]string
+	_ = cache.RegisterBatchLoader("dish", func(ctx context.Context, keys []string) (map[string]Cacheable, error) {
+		calls = append(calls, keys)
+		data := make(map[string]Cacheable)
+		for _, key := range keys {
+			if dish, err := GetDish(ctx, key); err == nil {
+				data[key] = dish
+			}
+		}
+		return data, nil
+	})
+
+	err = cache.RefreshMany(context.TODO(), "dish", []string{"1", "2", "3"})
+	assert.Len(t, calls, 1)
+	assert.Equal(t, []string{"1", "2", "3"}, calls[0])
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "data [3] of [dish] not found")
+}
+
+type Drink struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (p *Drink) Namespace() string {
+	return "drink"
+}
+
+func (p *Drink) Key() string {
+	return strconv.Itoa(p.ID)
+}
+
+func TestLevelCache_NamespaceMismatch(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.NotNil(t, cache.RegisterLoader("", GetDish))
+
+	// dish loader registered under the drink namespace
+	_ = cache.RegisterLoader("drink", GetDish)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("drink", "1"))
+	var drink Drink
+	err = cache.Get(context.TODO(), "1", &drink)
+	assert.True(t, errors.Is(err, ErrNamespaceMismatch))
+	_, ok := cache.c.Get(cache.cacheKey("drink", "1"))
+	assert.False(t, ok)
+
+	// no loader for the dish namespace at all
+	var dish Dish
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "1"))
+	err = cache.Get(context.TODO(), "1", &dish)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrNamespaceMismatch))
+
+	_ = cache.RegisterBatchLoader("drink", func(ctx context.Context, keys []string) (map[string]Cacheable, error) {
+		return map[string]Cacheable{"1": &Dish{ID: 1}}, nil
+	})
+	err = cache.RefreshMany(context.TODO(), "drink", []string{"1"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrNamespaceMismatch.Error())
+}
+
+// drinkLabel shares the namespace of Drink with a string id
+type drinkLabel struct {
+	ID string `json:"id"`
+}
+
+func (p *drinkLabel) Namespace() string {
+	return "drink"
+}
+
+func (p *drinkLabel) Key() string {
+	return p.ID
+}
+
+func TestLevelCache_LoadedShapeMismatch(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("drink", func(ctx context.Context, key string) (Cacheable, error) {
+		return &drinkLabel{ID: key}, nil
+	})
+	k := cache.cacheKey("drink", "cola")
+	cache.rdb.Del(context.TODO(), k)
+
+	var drink Drink
+	err = cache.Get(context.TODO(), "cola", &drink)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "*levelcache.drinkLabel")
+	assert.Contains(t, err.Error(), "*levelcache.Drink")
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+	assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), k).Err())
+}
+
+func TestLevelCache_GetOwnership(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	// the loader hands out the same pooled object every time
+	shared := &Dish{ID: 4, Name: "MaPoDouFu", Comment: "spicy"}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return shared, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "4"))
+
+	var first Dish
+	if err := cache.Get(context.TODO(), "4", &first); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	first.Name = "mutated"
+	shared.Comment = "mutated"
+
+	var second Dish
+	if err := cache.Get(context.TODO(), "4", &second); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.Equal(t, "MaPoDouFu", second.Name)
+	assert.Equal(t, "spicy", second.Comment)
+}
+
+func TestLevelCache_GetWithTTL(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		CacheExpiration: time.Minute,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	k := cache.cacheKey("dish", "1")
+	cache.rdb.Del(context.TODO(), k)
+
+	var dish Dish
+	for i := 0; i < 2; i++ {
+		// loaded first, then served by the local cache
+		ttl, err := cache.GetWithTTL(context.TODO(), "1", &dish)
+		assert.Nil(t, err)
+		assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+	}
+
+	cache.c.Delete(k)
+	cache.rdb.Expire(context.TODO(), k, 30*time.Second)
+	ttl, err := cache.GetWithTTL(context.TODO(), "1", &dish)
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(30*time.Second), float64(ttl), float64(time.Second))
+
+	cache.c.Delete(k)
+	cache.rdb.Persist(context.TODO(), k)
+	ttl, err = cache.GetWithTTL(context.TODO(), "1", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestLevelCache_GetWithSource(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	k := cache.cacheKey("dish", "2")
+	cache.rdb.Del(context.TODO(), k)
+
+	var dish Dish
+	for _, want := range []Source{SourceLoader, SourceLocal} {
+		src, err := cache.GetWithSource(context.TODO(), "2", &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, want, src, src.String())
+		assert.Equal(t, 2, dish.ID)
+	}
+	cache.c.Delete(k)
+	src, err := cache.GetWithSource(context.TODO(), "2", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceRedis, src, src.String())
+}
+
+func TestLevelCache_GetLocal(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 52, Name: "local"}))
+	cache.c.Delete(cache.cacheKey("dish", "53"))
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	var dish Dish
+	ok, err := cache.GetLocal("52", &dish)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "local", dish.Name)
+	ok, err = cache.GetLocal("53", &dish)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, counter.commands)
+	assert.Zero(t, loads)
+}
+
+func TestLevelCache_GetIfChanged(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 7, Name: "v1"}))
+	version, err := cache.currentVersion(context.TODO(), "dish", "7")
+	assert.Nil(t, err)
+
+	var unchanged Dish
+	changed, err := cache.GetIfChanged(context.TODO(), "dish", "7", version, &unchanged)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, Dish{}, unchanged)
+
+	// another instance writes a new value
+	other, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, other.Set(context.TODO(), &Dish{ID: 7, Name: "v2"}))
+
+	var dish Dish
+	changed, err = cache.GetIfChanged(context.TODO(), "dish", "7", version, &dish)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "v2", dish.Name)
+
+	_, err = cache.GetIfChanged(context.TODO(), "drink", "7", version, &dish)
+	assert.True(t, errors.Is(err, ErrNamespaceMismatch))
+}
+
+func TestLevelCache_Inspect(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	dish := &Dish{ID: 8, Name: "TangCuPaiGu"}
+	assert.Nil(t, cache.Set(context.TODO(), dish))
+	// diverge the local copy from redis
+	cache.c.SetDefault(cache.cacheKey("dish", "8"), `{"id":8}`)
+
+	local, remote, version, err := cache.Inspect(context.TODO(), "dish", "8")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":8}`, local)
+	assert.Equal(t, toJson(dish), remote)
+	current, _ := cache.currentVersion(context.TODO(), "dish", "8")
+	assert.Equal(t, current, version)
+	assert.True(t, version > 0)
+
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "missing"), cache.versionKey("dish", "missing"))
+	local, remote, version, err = cache.Inspect(context.TODO(), "dish", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, "", local)
+	assert.Equal(t, "", remote)
+	assert.Equal(t, int64(0), version)
+}
+
+func TestLevelCache_Namespaces(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Empty(t, cache.Namespaces())
+
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.RegisterLoaders(map[string]DataLoader{
+		"drink":    GetDish,
+		"bulkDish": getBulkDish,
+	})
+	_ = cache.RegisterBatchLoader("dish", nil)
+	_ = cache.RegisterBatchLoader("dessert", nil)
+	assert.Equal(t, []string{"bulkDish", "dessert", "dish", "drink"}, cache.Namespaces())
+}
+
+func TestLevelCache_Expiration(t *testing.T) {
+	for _, expiration := range []time.Duration{0, NoExpiration} {
+		cache, err := New(CacheConfig{
+			RedisAddr:       "localhost:6379",
+			RedisPoolSize:   10,
+			CacheExpiration: expiration,
+		})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		_ = cache.RegisterLoader("dish", GetDish)
+		k := cache.cacheKey("dish", "2")
+
+		for _, write := range []func() error{
+			func() error {
+				cache.rdb.Del(context.TODO(), k)
+				cache.c.Delete(k)
+				var dish Dish
+				return cache.Get(context.TODO(), "2", &dish)
+			},
+			func() error {
+				return cache.Set(context.TODO(), &Dish{ID: 2})
+			},
+		} {
+			assert.Nil(t, write())
+			ttl, err := cache.rdb.PTTL(context.TODO(), k).Result()
+			assert.Nil(t, err)
+			_, localExpiration, ok := cache.c.GetWithExpiration(k)
+			assert.True(t, ok)
+			if expiration == NoExpiration {
+				assert.Equal(t, NoExpiration, ttl)
+				assert.True(t, localExpiration.IsZero())
+			} else {
+				assert.InDelta(t, float64(defaultCacheInvalidInterval), float64(ttl), float64(time.Second))
+				assert.InDelta(t, float64(defaultCacheInvalidInterval), float64(time.Until(localExpiration)), float64(time.Second))
+			}
+		}
+	}
+}
+
+func TestLevelCache_LevelExpiration(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		LocalExpiration: time.Second,
+		RedisExpiration: time.Minute,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	k := cache.cacheKey("dish", "2")
+	cache.rdb.Del(context.TODO(), k)
+	cache.c.Delete(k)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	ttl, _ := cache.rdb.PTTL(context.TODO(), k).Result()
+	assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+	_, localExpiration, ok := cache.c.GetWithExpiration(k)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Second), float64(time.Until(localExpiration)), float64(100*time.Millisecond))
+
+	time.Sleep(1100 * time.Millisecond)
+	_, ok = cache.c.Get(k)
+	assert.False(t, ok)
+	src, err := cache.GetWithSource(context.TODO(), "2", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceRedis, src)
+	assert.Equal(t, 1, loads)
+	_, ok = cache.c.Get(k)
+	assert.True(t, ok)
+}
+
+func TestLevelCache_VersionEviction(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		CacheExpiration: 50 * time.Millisecond,
+		CleanupInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{Name: key}, nil
+	})
+	for i := 0; i < 100; i++ {
+		key := "evict" + strconv.Itoa(i)
+		cache.rdb.Del(context.TODO(), cache.cacheKey("dish", key))
+		var dish Dish
+		assert.Nil(t, cache.Get(context.TODO(), key, &dish))
+	}
+	cache.vmu.RLock()
+	assert.Len(t, cache.version, 100)
+	cache.vmu.RUnlock()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := cache.getVersion(cache.cacheKey("dish", "evict99")); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cache.vmu.RLock()
+	assert.Empty(t, cache.version)
+	cache.vmu.RUnlock()
+}
+
+func TestLevelCache_FlushLocal(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "1"))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, Stats{LocalHits: 1, Loads: 1}, cache.Stats())
+
+	cache.FlushLocal()
+	assert.Equal(t, 0, cache.c.ItemCount())
+	assert.Empty(t, cache.version)
+
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, Stats{LocalHits: 1, RedisHits: 1, Loads: 1}, cache.Stats())
+	assert.Equal(t, 1, dish.ID)
+}
+
+func TestLevelCache_LoaderTTL(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoaderWithTTL("dish", func(ctx context.Context, key string) (Cacheable, time.Duration, error) {
+		id, _ := strconv.Atoi(key)
+		return &Dish{ID: id}, 5 * time.Second, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "5"))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "5", &dish))
+	ttl, err := cache.rdb.PTTL(context.TODO(), cache.cacheKey("dish", "5")).Result()
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 5*time.Second)
+	_, expiration, ok := cache.c.GetWithExpiration(cache.cacheKey("dish", "5"))
+	assert.True(t, ok)
+	assert.True(t, time.Until(expiration) <= 5*time.Second)
+
+	cache.rdb.Persist(context.TODO(), cache.cacheKey("dish", "5"))
+	assert.Nil(t, cache.refresh(context.TODO(), "dish", "5", func() (Cacheable, time.Duration, error) {
+		return cache.load(context.TODO(), "dish", "5", cache.loaders["dish"])
+	}))
+	ttl, err = cache.rdb.PTTL(context.TODO(), cache.cacheKey("dish", "5")).Result()
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 5*time.Second)
+}
+
+func TestLevelCache_UpdateBufferFull(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		MaxUpdateBuffer: 1,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "2"))
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	cache.rdb.Incr(context.TODO(), cache.versionKey("dish", "2"))
+
+	// the worker is not started, the first update fills the buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("get blocked on a full update buffer")
+	}
+	assert.Equal(t, uint64(2), cache.Stats().DroppedUpdates)
+}
@@ -0,0 +1,354 @@
+package cachetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"levelcache"
+)
+
+// FakeCache keeps JSON values in memory with a version per key and loads misses with the registered loaders,
+// values never expire. Keys are "namespace/key", which is also what DeleteByPattern matches with path.Match.
+// The settings and introspection methods are those of NoopCache.
+type FakeCache struct {
+	NoopCache
+	mu       sync.Mutex
+	values   map[string][]byte
+	versions map[string]int64
+	loaders  map[string]levelcache.DataLoader
+	stats    levelcache.Stats
+}
+
+var _ levelcache.Cache = (*FakeCache)(nil)
+
+func NewFakeCache() *FakeCache {
+	return &FakeCache{
+		values:   make(map[string][]byte),
+		versions: make(map[string]int64),
+		loaders:  make(map[string]levelcache.DataLoader),
+	}
+}
+
+func fakeKey(namespace, key string) string {
+	return namespace + "/" + key
+}
+
+func (p *FakeCache) Get(ctx context.Context, key string, obj levelcache.Cacheable, opts ...levelcache.GetOption) error {
+	_, err := p.GetWithSource(ctx, key, obj, opts...)
+	return err
+}
+
+// GetWithSource reports values held by the fake as SourceLocal and loaded ones as SourceLoader
+func (p *FakeCache) GetWithSource(ctx context.Context, key string, obj levelcache.Cacheable, opts ...levelcache.GetOption) (levelcache.Source, error) {
+	k := fakeKey(obj.Namespace(), key)
+	p.mu.Lock()
+	content, ok := p.values[k]
+	loader, exist := p.loaders[obj.Namespace()]
+	if ok {
+		p.stats.LocalHits++
+	}
+	p.mu.Unlock()
+	if ok {
+		return levelcache.SourceLocal, json.Unmarshal(content, obj)
+	}
+	if !exist {
+		p.mu.Lock()
+		p.stats.Errors++
+		p.mu.Unlock()
+		return levelcache.SourceNone, fmt.Errorf("%w: [%s] of [%s]", ErrNotFound, key, obj.Namespace())
+	}
+	data, err := loader(ctx, key)
+	if err == nil {
+		content, err = json.Marshal(data)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.stats.Errors++
+		return levelcache.SourceNone, err
+	}
+	p.stats.Loads++
+	p.values[k] = content
+	return levelcache.SourceLoader, json.Unmarshal(content, obj)
+}
+
+// GetLocal reads the values held by the fake without loading misses
+func (p *FakeCache) GetLocal(key string, obj levelcache.Cacheable) (bool, error) {
+	p.mu.Lock()
+	content, ok := p.values[fakeKey(obj.Namespace(), key)]
+	if ok {
+		p.stats.LocalHits++
+	}
+	p.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(content, obj)
+}
+
+// GetOrSeed stores the JSON returned by seed for a missing key without calling the loader
+func (p *FakeCache) GetOrSeed(ctx context.Context, key string, obj levelcache.Cacheable, seed levelcache.Seed) error {
+	k := fakeKey(obj.Namespace(), key)
+	p.mu.Lock()
+	content, ok := p.values[k]
+	if ok {
+		p.stats.LocalHits++
+	}
+	p.mu.Unlock()
+	if !ok {
+		var err error
+		if content, err = seed(ctx, key); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.values[k] = content
+		p.mu.Unlock()
+	}
+	return json.Unmarshal(content, obj)
+}
+
+func (p *FakeCache) GetWithStale(ctx context.Context, key string, obj levelcache.Cacheable) (bool, error) {
+	return false, p.Get(ctx, key, obj)
+}
+
+func (p *FakeCache) GetWithTTL(ctx context.Context, key string, obj levelcache.Cacheable) (time.Duration, error) {
+	if err := p.Get(ctx, key, obj); err != nil {
+		return 0, err
+	}
+	return levelcache.NoExpiration, nil
+}
+
+func (p *FakeCache) GetIfChanged(ctx context.Context, namespace, key string, sinceVersion int64, obj levelcache.Cacheable) (bool, error) {
+	p.mu.Lock()
+	version := p.versions[fakeKey(namespace, key)]
+	p.mu.Unlock()
+	if version == sinceVersion {
+		return false, nil
+	}
+	return true, p.Get(ctx, key, obj)
+}
+
+func (p *FakeCache) Set(ctx context.Context, obj levelcache.Cacheable) error {
+	_, err := p.SetIfVersion(ctx, obj, -1)
+	return err
+}
+
+// SetIfVersion writes obj when its version is expectedVersion, a negative one writes unconditionally
+func (p *FakeCache) SetIfVersion(ctx context.Context, obj levelcache.Cacheable, expectedVersion int64) (bool, error) {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return false, err
+	}
+	k := fakeKey(obj.Namespace(), levelcache.ObjectKey(obj))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if expectedVersion >= 0 && p.versions[k] != expectedVersion {
+		return false, nil
+	}
+	p.values[k] = content
+	p.versions[k]++
+	return true, nil
+}
+
+func (p *FakeCache) SetAsync(ctx context.Context, obj levelcache.Cacheable) {
+	_ = p.Set(ctx, obj)
+}
+
+// Refresh drops the value of key so that the next Get loads it again, there is nothing to wait for
+func (p *FakeCache) Refresh(ctx context.Context, namespace, key string) *levelcache.RefreshHandle {
+	p.mu.Lock()
+	delete(p.values, fakeKey(namespace, key))
+	p.versions[fakeKey(namespace, key)]++
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *FakeCache) RefreshMany(ctx context.Context, namespace string, keys []string) error {
+	for _, key := range keys {
+		p.Refresh(ctx, namespace, key)
+	}
+	return nil
+}
+
+func (p *FakeCache) DeleteByPattern(ctx context.Context, pattern string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	removed := 0
+	for k := range p.values {
+		matched, err := path.Match(pattern, k)
+		if err != nil {
+			return removed, err
+		}
+		if matched {
+			delete(p.values, k)
+			delete(p.versions, k)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (p *FakeCache) RegisterLoader(namespace string, loader levelcache.DataLoader) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.loaders[namespace]; ok {
+		return fmt.Errorf("data loader [%s] existed", namespace)
+	}
+	p.loaders[namespace] = loader
+	return nil
+}
+
+func (p *FakeCache) Start(ctx context.Context) error {
+	return nil
+}
+
+func (p *FakeCache) Stop() {}
+
+func (p *FakeCache) Close() error {
+	return nil
+}
+
+// Stats counts the values served from memory as LocalHits
+func (p *FakeCache) Stats() levelcache.Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *FakeCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (p *FakeCache) GetVersioned(ctx context.Context, key string, obj levelcache.Cacheable) (int64, error) {
+	if err := p.Get(ctx, key, obj); err != nil {
+		return 0, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.versions[fakeKey(obj.Namespace(), key)], nil
+}
+
+// GetMany reads keys one by one, stopping at the first key which fails
+func (p *FakeCache) GetMany(ctx context.Context, namespace string, keys []string, newObj func() levelcache.Cacheable) (map[string]levelcache.Cacheable, error) {
+	objs := make(map[string]levelcache.Cacheable, len(keys))
+	for _, key := range keys {
+		obj := newObj()
+		if err := p.Get(ctx, key, obj); err != nil {
+			return objs, err
+		}
+		objs[key] = obj
+	}
+	return objs, nil
+}
+
+func (p *FakeCache) MSet(ctx context.Context, objs []levelcache.Cacheable) error {
+	for _, obj := range objs {
+		if err := p.Set(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Touch only checks that the fake holds key, its values never expire
+func (p *FakeCache) Touch(ctx context.Context, namespace, key string, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.values[fakeKey(namespace, key)]; !ok {
+		return fmt.Errorf("%w: [%s] of [%s]", ErrNotFound, key, namespace)
+	}
+	return nil
+}
+
+func (p *FakeCache) Delete(ctx context.Context, namespace, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.values, fakeKey(namespace, key))
+	delete(p.versions, fakeKey(namespace, key))
+	return nil
+}
+
+func (p *FakeCache) DeleteIfVersion(ctx context.Context, namespace, key string, expectedVersion int64) (bool, error) {
+	k := fakeKey(namespace, key)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.versions[k] != expectedVersion {
+		return false, nil
+	}
+	delete(p.values, k)
+	delete(p.versions, k)
+	return true, nil
+}
+
+func (p *FakeCache) ClearNamespace(ctx context.Context, namespace string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear(namespace)
+	return nil
+}
+
+// ReloadNamespace replaces the loader of namespace and drops its values
+func (p *FakeCache) ReloadNamespace(ctx context.Context, namespace string, loader levelcache.DataLoader) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loaders[namespace] = loader
+	p.clear(namespace)
+	return nil
+}
+
+// clear drops the values of namespace and their versions, p.mu held
+func (p *FakeCache) clear(namespace string) {
+	for k := range p.values {
+		if strings.HasPrefix(k, namespace+"/") {
+			delete(p.values, k)
+		}
+	}
+	for k := range p.versions {
+		if strings.HasPrefix(k, namespace+"/") {
+			delete(p.versions, k)
+		}
+	}
+}
+
+// RegisterLoaderWithTTL registers loader dropping the ttl it returns, values never expire
+func (p *FakeCache) RegisterLoaderWithTTL(namespace string, loader levelcache.DataLoaderWithTTL) error {
+	return p.RegisterLoader(namespace, func(ctx context.Context, key string) (levelcache.Cacheable, error) {
+		data, _, err := loader(ctx, key)
+		return data, err
+	})
+}
+
+func (p *FakeCache) RegisterTypedLoader(sample levelcache.Cacheable, loader levelcache.DataLoader) error {
+	return p.RegisterLoader(sample.Namespace(), loader)
+}
+
+func (p *FakeCache) RegisterLoaders(loaders map[string]levelcache.DataLoader) {
+	for namespace, loader := range loaders {
+		_ = p.RegisterLoader(namespace, loader)
+	}
+}
+
+func (p *FakeCache) Namespaces() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	namespaces := make([]string, 0, len(p.loaders))
+	for namespace := range p.loaders {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+func (p *FakeCache) DataKey(namespace, key string) string {
+	return fakeKey(namespace, key)
+}
+
+func (p *FakeCache) VersionKey(namespace, key string) string {
+	return fakeKey(namespace, key)
+}
@@ -0,0 +1,80 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"levelcache"
+	"strconv"
+	"testing"
+)
+
+type dish struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (p *dish) Namespace() string {
+	return "dish"
+}
+
+func (p *dish) Key() string {
+	return strconv.Itoa(p.ID)
+}
+
+type drink struct {
+	dish
+}
+
+func (p *drink) Namespace() string {
+	return "drink"
+}
+
+func TestFakeCache(t *testing.T) {
+	var cache levelcache.Cache = NewFakeCache()
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (levelcache.Cacheable, error) {
+		loads++
+		id, _ := strconv.Atoi(key)
+		return &dish{ID: id, Name: "loaded"}, nil
+	})
+
+	var got dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &got))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &got))
+	assert.Equal(t, dish{ID: 1, Name: "loaded"}, got)
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, levelcache.Stats{LocalHits: 1, Loads: 1}, cache.Stats())
+
+	assert.Nil(t, cache.Set(context.TODO(), &dish{ID: 1, Name: "set"}))
+	changed, err := cache.GetIfChanged(context.TODO(), "dish", "1", 0, &got)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "set", got.Name)
+	ok, err := cache.SetIfVersion(context.TODO(), &dish{ID: 1}, 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	removed, err := cache.DeleteByPattern(context.TODO(), "dish/*")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Nil(t, cache.Get(context.TODO(), "1", &got))
+	assert.Equal(t, 2, loads)
+
+	assert.Nil(t, cache.Set(context.TODO(), &dish{ID: 2, Name: "set"}))
+	version, err := cache.GetVersioned(context.TODO(), "2", &got)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Nil(t, cache.Delete(context.TODO(), "dish", "2"))
+	assert.True(t, errors.Is(cache.Touch(context.TODO(), "dish", "2", 0), ErrNotFound))
+
+	var other drink
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "1", &other), ErrNotFound))
+}
+
+func TestNoopCache(t *testing.T) {
+	var cache levelcache.Cache = NoopCache{}
+	assert.Nil(t, cache.Set(context.TODO(), &dish{ID: 1}))
+	var got dish
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "1", &got), ErrNotFound))
+}
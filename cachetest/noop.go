@@ -0,0 +1,215 @@
+// Package cachetest provides implementations of levelcache.Cache for the tests of its users.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"levelcache"
+)
+
+// ErrNotFound is returned by the reads of keys a fake cache cannot serve
+var ErrNotFound = errors.New("cachetest: not found")
+
+// NoopCache caches nothing, every read misses with ErrNotFound and every write is dropped
+type NoopCache struct{}
+
+var _ levelcache.Cache = NoopCache{}
+
+func (NoopCache) Get(ctx context.Context, key string, obj levelcache.Cacheable, opts ...levelcache.GetOption) error {
+	return ErrNotFound
+}
+
+func (NoopCache) GetWithSource(ctx context.Context, key string, obj levelcache.Cacheable, opts ...levelcache.GetOption) (levelcache.Source, error) {
+	return levelcache.SourceNone, ErrNotFound
+}
+
+func (NoopCache) GetLocal(key string, obj levelcache.Cacheable) (bool, error) {
+	return false, nil
+}
+
+func (NoopCache) GetOrSeed(ctx context.Context, key string, obj levelcache.Cacheable, seed levelcache.Seed) error {
+	return ErrNotFound
+}
+
+func (NoopCache) GetWithStale(ctx context.Context, key string, obj levelcache.Cacheable) (bool, error) {
+	return false, ErrNotFound
+}
+
+func (NoopCache) GetWithTTL(ctx context.Context, key string, obj levelcache.Cacheable) (time.Duration, error) {
+	return 0, ErrNotFound
+}
+
+func (NoopCache) GetIfChanged(ctx context.Context, namespace, key string, sinceVersion int64, obj levelcache.Cacheable) (bool, error) {
+	return false, ErrNotFound
+}
+
+func (NoopCache) Set(ctx context.Context, obj levelcache.Cacheable) error {
+	return nil
+}
+
+func (NoopCache) SetIfVersion(ctx context.Context, obj levelcache.Cacheable, expectedVersion int64) (bool, error) {
+	return true, nil
+}
+
+func (NoopCache) SetAsync(ctx context.Context, obj levelcache.Cacheable) {}
+
+func (NoopCache) Refresh(ctx context.Context, namespace, key string) *levelcache.RefreshHandle {
+	return nil
+}
+
+func (NoopCache) RefreshMany(ctx context.Context, namespace string, keys []string) error {
+	return nil
+}
+
+func (NoopCache) DeleteByPattern(ctx context.Context, pattern string) (int, error) {
+	return 0, nil
+}
+
+func (NoopCache) RegisterLoader(namespace string, loader levelcache.DataLoader) error {
+	return nil
+}
+
+func (NoopCache) Start(ctx context.Context) error {
+	return nil
+}
+
+func (NoopCache) Stop() {}
+
+func (NoopCache) Close() error {
+	return nil
+}
+
+func (NoopCache) Stats() levelcache.Stats {
+	return levelcache.Stats{}
+}
+
+func (NoopCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (NoopCache) GetVersioned(ctx context.Context, key string, obj levelcache.Cacheable) (int64, error) {
+	return 0, ErrNotFound
+}
+
+func (NoopCache) GetMany(ctx context.Context, namespace string, keys []string, newObj func() levelcache.Cacheable) (map[string]levelcache.Cacheable, error) {
+	return map[string]levelcache.Cacheable{}, nil
+}
+
+func (NoopCache) GetList(ctx context.Context, namespace, key string, out interface{}) error {
+	return ErrNotFound
+}
+
+func (NoopCache) MSet(ctx context.Context, objs []levelcache.Cacheable) error {
+	return nil
+}
+
+func (NoopCache) Touch(ctx context.Context, namespace, key string, ttl time.Duration) error {
+	return ErrNotFound
+}
+
+func (NoopCache) AutoRefresh(namespace string, keys []string, interval time.Duration) {}
+
+func (NoopCache) StopAutoRefresh(namespace string, keys ...string) {}
+
+func (NoopCache) PrewarmLocal(ctx context.Context, namespace string, keys []string) error {
+	return nil
+}
+
+func (NoopCache) Delete(ctx context.Context, namespace, key string) error {
+	return nil
+}
+
+func (NoopCache) DeleteIfVersion(ctx context.Context, namespace, key string, expectedVersion int64) (bool, error) {
+	return true, nil
+}
+
+func (NoopCache) ClearNamespace(ctx context.Context, namespace string) error {
+	return nil
+}
+
+func (NoopCache) ReloadNamespace(ctx context.Context, namespace string, loader levelcache.DataLoader) error {
+	return nil
+}
+
+func (NoopCache) FlushLocal() {}
+
+func (NoopCache) RegisterLoaderWithTTL(namespace string, loader levelcache.DataLoaderWithTTL) error {
+	return nil
+}
+
+func (NoopCache) RegisterTypedLoader(sample levelcache.Cacheable, loader levelcache.DataLoader) error {
+	return nil
+}
+
+func (NoopCache) RegisterBatchLoader(namespace string, loader levelcache.BatchDataLoader) error {
+	return nil
+}
+
+func (NoopCache) RegisterListLoader(namespace string, loader levelcache.ListDataLoader) error {
+	return nil
+}
+
+func (NoopCache) RegisterLoaderChain(namespace string, loaders ...levelcache.DataLoader) error {
+	return nil
+}
+
+func (NoopCache) RegisterLoaders(loaders map[string]levelcache.DataLoader) {}
+
+func (NoopCache) UseLoaderMiddleware(mw func(levelcache.DataLoader) levelcache.DataLoader) {}
+
+func (NoopCache) Namespaces() []string {
+	return nil
+}
+
+func (NoopCache) SetLocalCacheDisabled(namespace string, disabled bool) {}
+
+func (NoopCache) SetAlwaysReadRedis(namespace string, enabled bool) {}
+
+func (NoopCache) SetVersioningDisabled(namespace string, disabled bool) {}
+
+func (NoopCache) SetHashStorage(namespace string, enabled bool) {}
+
+func (NoopCache) SetLockInterval(namespace string, interval time.Duration) {}
+
+func (NoopCache) SetValidator(namespace string, validate func(obj levelcache.Cacheable) error) {}
+
+func (NoopCache) SetMaxConcurrentLoads(namespace string, limit int) {}
+
+func (NoopCache) SetNamespaceSerializer(namespace string, s levelcache.Serializer) {}
+
+func (NoopCache) SetNamespaceSchema(namespace string, version int, migrate levelcache.Migrate) {}
+
+func (NoopCache) SetRedisMemoryLimit(namespace string, limit int64) {}
+
+func (NoopCache) SetUpdateBuffer(n int) {}
+
+func (NoopCache) OnInvalidate(fn func(namespace, key string)) {}
+
+func (NoopCache) OnLocalEviction(fn func(namespace, key string, reason levelcache.EvictReason)) {}
+
+// Events returns a nil channel, receiving from it blocks forever as nothing ever changes
+func (NoopCache) Events() <-chan levelcache.CacheEvent {
+	return nil
+}
+
+func (NoopCache) DataKey(namespace, key string) string {
+	return namespace + "/" + key
+}
+
+func (NoopCache) VersionKey(namespace, key string) string {
+	return namespace + "/" + key
+}
+
+func (NoopCache) Inspect(ctx context.Context, namespace, key string) (string, string, int64, error) {
+	return "", "", 0, nil
+}
+
+func (NoopCache) History(ctx context.Context, namespace, key string, limit int) ([]string, error) {
+	return nil, nil
+}
+
+func (NoopCache) Health(ctx context.Context) levelcache.HealthStatus {
+	return levelcache.HealthStatus{RedisReachable: true}
+}
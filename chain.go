@@ -0,0 +1,37 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RegisterLoaderChain registers loaders as the loader of namespace, tried in order until one succeeds,
+// e.g. a primary source followed by a snapshot service serving slightly older data when it is down.
+// The first value loaded is cached like the value of any loader, Hooks.OnLoaderFallback reports the values
+// served by a loader after the first one. When every loader fails the error of the last one is returned.
+func (p *LevelCache) RegisterLoaderChain(namespace string, loaders ...DataLoader) error {
+	if len(loaders) == 0 {
+		return fmt.Errorf("empty loader chain [%s]", namespace)
+	}
+	return p.RegisterLoaderWithTTL(namespace, func(ctx context.Context, key string) (Cacheable, time.Duration, error) {
+		var errs []error
+		for i, loader := range loaders {
+			data, err := loader(ctx, key)
+			if err == nil {
+				if i > 0 && p.cfg.Hooks.OnLoaderFallback != nil {
+					p.cfg.Hooks.OnLoaderFallback(namespace, key, i, errs)
+				}
+				return data, 0, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(errs) == 1 {
+			return nil, 0, errs[0]
+		}
+		return nil, 0, fmt.Errorf("%d chained loaders fail, last: %w", len(errs), errs[len(errs)-1])
+	})
+}
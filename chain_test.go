@@ -0,0 +1,56 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_RegisterLoaderChain(t *testing.T) {
+	var fallbacks []int
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		Hooks: Hooks{
+			OnLoaderFallback: func(namespace, key string, index int, errs []error) {
+				fallbacks = append(fallbacks, index)
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	primaryDown := errors.New("primary down")
+	snapshotMiss := errors.New("not in snapshot")
+	err = cache.RegisterLoaderChain("dish",
+		func(ctx context.Context, key string) (Cacheable, error) {
+			return nil, primaryDown
+		},
+		func(ctx context.Context, key string) (Cacheable, error) {
+			if key == "77" {
+				return nil, snapshotMiss
+			}
+			return &Dish{ID: 76, Name: "snapshot"}, nil
+		},
+	)
+	assert.Nil(t, err)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "76"), cache.cacheKey("dish", "77"))
+
+	var dish Dish
+	src, err := cache.GetWithSource(context.TODO(), "76", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLoader, src)
+	assert.Equal(t, "snapshot", dish.Name)
+	assert.Equal(t, []int{1}, fallbacks)
+	remote, err := cache.rdb.Get(context.TODO(), cache.cacheKey("dish", "76")).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, toJson(&dish), remote)
+
+	err = cache.Get(context.TODO(), "77", &dish)
+	assert.True(t, errors.Is(err, snapshotMiss))
+	assert.Equal(t, []int{1}, fallbacks)
+
+	assert.NotNil(t, cache.RegisterLoaderChain("drink"))
+}
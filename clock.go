@@ -0,0 +1,19 @@
+package levelcache
+
+import "time"
+
+// Clock is the source of time of the cache, tests replace it to control timing without sleeping
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
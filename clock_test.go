@@ -0,0 +1,86 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced, its After channels fire once their deadline is passed
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (p *fakeClock) Now() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.now
+}
+
+func (p *fakeClock) After(d time.Duration) <-chan time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := make(chan time.Time, 1)
+	p.waiters = append(p.waiters, fakeWaiter{deadline: p.now.Add(d), c: c})
+	return c
+}
+
+func (p *fakeClock) Advance(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.now = p.now.Add(d)
+	waiters := p.waiters[:0]
+	for _, w := range p.waiters {
+		if w.deadline.After(p.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- p.now
+	}
+	p.waiters = waiters
+}
+
+func TestLevelCache_Clock(t *testing.T) {
+	var slowKeys []string
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	cache, err := New(CacheConfig{
+		RedisAddr:           "localhost:6379",
+		RedisPoolSize:       10,
+		SlowLoaderThreshold: time.Second,
+		Logger:              &recordLogger{},
+		Clock:               clock,
+		Hooks: Hooks{
+			OnSlowLoader: func(namespace, key string, d time.Duration) {
+				slowKeys = append(slowKeys, key)
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if key == "at" {
+			clock.Advance(time.Second)
+		} else {
+			clock.Advance(time.Second + time.Nanosecond)
+		}
+		return &Dish{ID: 3}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "at"), cache.cacheKey("dish", "past"))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "at", &dish))
+	assert.Empty(t, slowKeys)
+	assert.Nil(t, cache.Get(context.TODO(), "past", &dish))
+	assert.Equal(t, []string{"past"}, slowKeys)
+}
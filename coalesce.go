@@ -0,0 +1,57 @@
+package levelcache
+
+import (
+	"context"
+	"sync"
+)
+
+// coalescer holds the latest redis write of each key delayed by WriteCoalesceWindow,
+// flushes tracks the goroutines waiting for the window of a key to write it
+type coalescer struct {
+	mu      sync.Mutex
+	pending map[string]writeTask
+	flushes sync.WaitGroup
+	// closed refuses new writes once Close waits for flushes, guarded by mu
+	closed bool
+}
+
+func (p *coalescer) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+}
+
+// coalesce delays the redis write of w by WriteCoalesceWindow, a write already pending for the key is replaced
+// so that only the latest one reaches redis once the window elapsed or the cache is closed.
+// It returns ErrClosed once Close was called, Close waiting for the writes scheduled before.
+func (p *LevelCache) coalesce(w writeTask) error {
+	k := p.cacheKey(w.namespace, w.key)
+	p.coalescer.mu.Lock()
+	if p.coalescer.closed {
+		p.coalescer.mu.Unlock()
+		return ErrClosed
+	}
+	_, scheduled := p.coalescer.pending[k]
+	p.coalescer.pending[k] = w
+	if !scheduled {
+		p.coalescer.flushes.Add(1)
+	}
+	p.coalescer.mu.Unlock()
+	if scheduled {
+		return nil
+	}
+	go func() {
+		defer p.coalescer.flushes.Done()
+		select {
+		case <-p.cfg.Clock.After(p.cfg.WriteCoalesceWindow):
+		case <-p.done:
+		}
+		p.coalescer.mu.Lock()
+		w := p.coalescer.pending[k]
+		delete(p.coalescer.pending, k)
+		p.coalescer.mu.Unlock()
+		// the caller of Set may be long gone, its context must not abandon the write
+		p.write(context.Background(), w)
+	}()
+	return nil
+}
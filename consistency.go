@@ -0,0 +1,65 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"math/rand"
+)
+
+// shouldCheckConsistency samples the local hits verified against redis by ConsistencyCheckRate
+func (p *LevelCache) shouldCheckConsistency() bool {
+	rate := p.cfg.ConsistencyCheckRate
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// verifyLocal returns the content of a local hit to serve. It is checked against redis on every
+// StrictConsistency read and on the reads sampled by ConsistencyCheckRate, a strict read returns
+// an empty content when the value is gone from redis so that it is read through.
+func (p *LevelCache) verifyLocal(ctx context.Context, namespace, key, content string, strict bool) (string, error) {
+	if p.versioningDisabled(namespace) || p.localOnly() {
+		return content, nil
+	}
+	if strict {
+		repaired, err := p.repairLocal(ctx, namespace, key, content)
+		if err == redis.Nil {
+			p.c.Delete(p.cacheKey(namespace, key))
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("verify local [%s] key [%s]: %w", namespace, key, err)
+		}
+		return repaired, nil
+	}
+	if p.shouldCheckConsistency() {
+		content, _ = p.repairLocal(ctx, namespace, key, content)
+	}
+	return content, nil
+}
+
+// repairLocal compares the version of a local hit with redis and replaces the local content
+// by the redis one when they diverged, returning the content to serve.
+// The local content is returned along with the error when redis could not be read.
+func (p *LevelCache) repairLocal(ctx context.Context, namespace, key, content string) (string, error) {
+	k := p.cacheKey(namespace, key)
+	current, err := p.currentVersion(ctx, namespace, key)
+	if err != nil {
+		return content, err
+	}
+	if v, ok := p.getVersion(k); ok && v == current {
+		return content, nil
+	}
+	remote, err := p.getEntry(ctx, p.rdb, namespace, key).Result()
+	if err == nil {
+		remote, err = liveEntry(remote)
+	}
+	if err != nil {
+		return content, err
+	}
+	if remote != content {
+		p.cfg.Logger.Printf("local [%s] diverged from redis at version %d, repaired", k, current)
+		p.c.SetDefault(k, remote)
+	}
+	p.setVersion(k, current)
+	return remote, nil
+}
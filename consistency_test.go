@@ -0,0 +1,79 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_ConsistencyCheck(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:            "localhost:6379",
+		RedisPoolSize:        10,
+		ConsistencyCheckRate: 1,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	k := cache.cacheKey("dish", "11")
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 11, Name: "v1"}))
+
+	// desync: the local entry drifts and redis moves on without this instance noticing
+	cache.c.SetDefault(k, toJson(&Dish{ID: 11, Name: "drifted"}))
+	cache.setVersion(k, 0)
+
+	var dish Dish
+	_, err = cache.get(context.TODO(), "11", &dish, getOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", dish.Name)
+	local, remote, version, err := cache.Inspect(context.TODO(), "dish", "11")
+	assert.Nil(t, err)
+	assert.Equal(t, remote, local)
+	current, _ := cache.getVersion(k)
+	assert.Equal(t, version, current)
+
+	// without sampling the drift is served as is
+	cache.cfg.ConsistencyCheckRate = 0
+	cache.c.SetDefault(k, toJson(&Dish{ID: 11, Name: "drifted"}))
+	cache.setVersion(k, 0)
+	_, err = cache.get(context.TODO(), "11", &dish, getOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "drifted", dish.Name)
+}
+
+func TestLevelCache_StrictConsistency(t *testing.T) {
+	a, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	b, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, a.Set(context.TODO(), &Dish{ID: 64, Name: "v1"}))
+	// b bumps the version, a is not started and never hears of it
+	assert.Nil(t, b.Set(context.TODO(), &Dish{ID: 64, Name: "v2"}))
+
+	var dish Dish
+	assert.Nil(t, a.Get(context.TODO(), "64", &dish))
+	assert.Equal(t, "v1", dish.Name)
+	src, err := a.GetWithSource(context.TODO(), "64", &dish, StrictConsistency())
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLocal, src)
+	assert.Equal(t, "v2", dish.Name)
+	assert.Nil(t, a.Get(context.TODO(), "64", &dish))
+	assert.Equal(t, "v2", dish.Name)
+
+	// the value is gone from redis, the strict read goes to the loader
+	_ = a.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 64, Name: "loaded"}, nil
+	})
+	b.rdb.Del(context.TODO(), b.cacheKey("dish", "64"), b.cacheKey("version", "dish", "64"))
+	src, err = a.GetWithSource(context.TODO(), "64", &dish, StrictConsistency())
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLoader, src)
+	assert.Equal(t, "loaded", dish.Name)
+}
@@ -0,0 +1,38 @@
+package levelcache
+
+import "sync"
+
+// debouncer holds the latest refresh of each key while it runs
+type debouncer struct {
+	mu        sync.Mutex
+	refreshes map[string]*RefreshHandle
+}
+
+// debounce returns the refresh of key to join, or a new one the caller must run and settle when it reports true.
+// Only a refresh running for less than RefreshDebounce is joined, and none without it: a refresh running
+// may have read the source before the change the caller refreshes for.
+func (p *LevelCache) debounce(namespace, key string) (*RefreshHandle, bool) {
+	h := &RefreshHandle{done: make(chan struct{}), started: p.cfg.Clock.Now()}
+	if p.cfg.RefreshDebounce <= 0 {
+		return h, true
+	}
+	k := p.cacheKey(namespace, key)
+	p.debouncer.mu.Lock()
+	defer p.debouncer.mu.Unlock()
+	if running, ok := p.debouncer.refreshes[k]; ok && h.started.Sub(running.started) < p.cfg.RefreshDebounce {
+		return running, false
+	}
+	p.debouncer.refreshes[k] = h
+	return h, true
+}
+
+// settle completes the refresh h of key and forgets it, the next Refresh of key reloads again
+func (p *LevelCache) settle(namespace, key string, h *RefreshHandle) {
+	close(h.done)
+	k := p.cacheKey(namespace, key)
+	p.debouncer.mu.Lock()
+	if p.debouncer.refreshes[k] == h {
+		delete(p.debouncer.refreshes, k)
+	}
+	p.debouncer.mu.Unlock()
+}
@@ -0,0 +1,139 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// deleteBatch is the COUNT hint of the SCAN walking the keys to delete and the most keys deleted at once
+const deleteBatch = 100
+
+// deleteScript removes the value KEYS[1] and its version KEYS[2] when the version is ARGV[1], zero standing
+// for a key never written, a non empty ARGV[2] being the field of the hash KEYS[1] holding the value.
+// It returns 1 when they were removed and 0 when the version differs.
+var deleteScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[2]) or "0") ~= tonumber(ARGV[1]) then
+	return 0
+end
+if ARGV[2] == "" then
+	redis.call("DEL", KEYS[1], KEYS[2])
+else
+	redis.call("HDEL", KEYS[1], ARGV[2])
+	redis.call("DEL", KEYS[2])
+end
+return 1
+`)
+
+// Delete removes the value of key and its version whatever the version is and evicts its local entry,
+// only the local entry being evicted without redis.
+func (p *LevelCache) Delete(ctx context.Context, namespace, key string) error {
+	if !p.localOnly() {
+		sk, field := p.storageKey(namespace, key)
+		pipe := p.rdb.Pipeline()
+		if field != "" {
+			pipe.HDel(ctx, sk, field)
+		} else {
+			pipe.Del(ctx, sk)
+		}
+		pipe.Del(ctx, p.versionKey(namespace, key))
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("delete [%s] key [%s]: %w", namespace, key, err)
+		}
+	}
+	p.c.Delete(p.cacheKey(namespace, key))
+	p.invalidated(EventDelete, namespace, key)
+	return nil
+}
+
+// DeleteIfVersion removes the value of key and its version only when the version equals expectedVersion,
+// so that a value rewritten by another writer since it was read is kept. It reports whether the delete happened,
+// the local entry being evicted when it did.
+func (p *LevelCache) DeleteIfVersion(ctx context.Context, namespace, key string, expectedVersion int64) (bool, error) {
+	if p.localOnly() {
+		return false, ErrRedisDisabled
+	}
+	if p.versioningDisabled(namespace) {
+		return false, ErrVersioningDisabled
+	}
+	sk, field := p.storageKey(namespace, key)
+	deleted, err := deleteScript.Run(ctx, p.rdb, []string{sk, p.versionKey(namespace, key)}, expectedVersion, field).Int()
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+	p.c.Delete(p.cacheKey(namespace, key))
+	p.invalidated(EventDelete, namespace, key)
+	return true, nil
+}
+
+// DeleteByPattern removes the values whose key, as built by KeyEncoder, matches the redis glob pattern,
+// e.g. "dish#$#1*" with the default encoder, and returns how many values were removed.
+// Their local entries are evicted and, with the default KeyEncoder, their versions are removed too,
+// a custom KeyEncoder cannot tell data keys from version keys so pattern must only match data keys.
+// The hashes of the namespaces with HashStorage are skipped, see ClearNamespace.
+// Keys are walked with SCAN, the blocking KEYS command is never used.
+func (p *LevelCache) DeleteByPattern(ctx context.Context, pattern string) (int, error) {
+	return p.deleteByPattern(ctx, pattern, func(namespace, key string) {
+		p.invalidated(EventDelete, namespace, key)
+	})
+}
+
+// deleteByPattern is DeleteByPattern reporting each removed value to deleted instead of invalidating it
+func (p *LevelCache) deleteByPattern(ctx context.Context, pattern string, deleted func(namespace, key string)) (int, error) {
+	if p.localOnly() {
+		return 0, ErrRedisDisabled
+	}
+	_, canSplit := p.cfg.KeyEncoder.(keySplitter)
+	removed := 0
+	iter := p.rdb.Scan(ctx, 0, pattern, deleteBatch).Iterator()
+	keys := make([]string, 0, deleteBatch)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		pipe := p.rdb.Pipeline()
+		del := pipe.Del(ctx, keys...)
+		if canSplit {
+			for _, k := range keys {
+				parts, _ := p.splitKey(k)
+				pipe.Del(ctx, p.versionKey(parts[0], parts[1]))
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		removed += int(del.Val())
+		for _, k := range keys {
+			p.c.Delete(k)
+			if canSplit {
+				parts, _ := p.splitKey(k)
+				deleted(parts[0], parts[1])
+			} else {
+				deleted("", k)
+			}
+		}
+		keys = keys[:0]
+		return nil
+	}
+	for iter.Next(ctx) {
+		k := iter.Val()
+		if canSplit {
+			// version, stale and lock keys have more parts than the namespace and key of a value,
+			// the hashes of the namespaces with HashStorage are left to ClearNamespace
+			if parts, ok := p.splitKey(k); !ok || len(parts) != 2 || parts[0] == hashKeyPart {
+				continue
+			}
+		}
+		keys = append(keys, k)
+		if len(keys) == deleteBatch {
+			if err := flush(); err != nil {
+				return removed, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return removed, err
+	}
+	return removed, flush()
+}
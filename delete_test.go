@@ -0,0 +1,139 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSplitJointKey(t *testing.T) {
+	for _, parts := range [][]string{{"dish", "1"}, {"version", "dish", "1"}, {"a#$#b", `c\`, ""}} {
+		split, ok := splitJointKey(jointKey(parts...))
+		assert.True(t, ok)
+		assert.Equal(t, parts, split)
+	}
+	_, ok := splitJointKey("dish#1")
+	assert.False(t, ok)
+}
+
+func TestLevelCache_Delete(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var invalidated []string
+	cache.OnInvalidate(func(namespace, key string) {
+		invalidated = append(invalidated, key)
+	})
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 100, Name: "deleted"}))
+	assert.Nil(t, cache.Delete(context.TODO(), "dish", "100"))
+	assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), cache.cacheKey("dish", "100")).Err())
+	assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), cache.versionKey("dish", "100")).Err())
+	_, ok := cache.c.Get(cache.cacheKey("dish", "100"))
+	assert.False(t, ok)
+	assert.Equal(t, []string{"100"}, invalidated)
+	// deleting a missing key is not an error
+	assert.Nil(t, cache.Delete(context.TODO(), "dish", "100"))
+}
+
+func TestLevelCache_DeleteByPattern(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	for _, id := range []int{1, 2, 3} {
+		assert.Nil(t, cache.Set(context.TODO(), &Drink{ID: id, Name: "tea"}))
+	}
+	assert.Nil(t, cache.Set(context.TODO(), &Drink{ID: 21, Name: "coffee"}))
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 2}))
+
+	removed, err := cache.DeleteByPattern(context.TODO(), cache.cacheKey("drink", "?"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, removed)
+	for _, key := range []string{"1", "2", "3"} {
+		assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), cache.cacheKey("drink", key)).Err())
+		assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), cache.versionKey("drink", key)).Err())
+		_, ok := cache.c.Get(cache.cacheKey("drink", key))
+		assert.False(t, ok)
+	}
+	assert.Nil(t, cache.rdb.Get(context.TODO(), cache.cacheKey("drink", "21")).Err())
+	assert.Nil(t, cache.rdb.Get(context.TODO(), cache.versionKey("drink", "21")).Err())
+	assert.Nil(t, cache.rdb.Get(context.TODO(), cache.cacheKey("dish", "2")).Err())
+
+	removed, err = cache.DeleteByPattern(context.TODO(), cache.cacheKey("drink", "?"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestLevelCache_DeleteByPatternHashStorage(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	cache.SetHashStorage("dish", true)
+	defer cache.ClearNamespace(ctx, "dish")
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 95}))
+	var deleted [][2]string
+	cache.OnInvalidate(func(namespace, key string) {
+		deleted = append(deleted, [2]string{namespace, key})
+	})
+
+	// the hash holding the namespace is no value of namespace "hash"
+	removed, err := cache.DeleteByPattern(ctx, hashKeyPart+"*")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Empty(t, deleted)
+	assert.True(t, cache.rdb.HExists(ctx, cache.hashKey("dish"), "95").Val())
+}
+
+func TestLevelCache_DeleteIfVersion(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	k := cache.DataKey("dish", "49")
+	cache.rdb.Del(ctx, k, cache.VersionKey("dish", "49"))
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 49, Name: "first"}))
+	read, err := cache.currentVersion(ctx, "dish", "49")
+	assert.Nil(t, err)
+
+	// another writer refreshes the value after it was read
+	refreshed := make(chan error)
+	go func() {
+		refreshed <- cache.refresh(ctx, "dish", "49", func() (Cacheable, time.Duration, error) {
+			return &Dish{ID: 49, Name: "second"}, 0, nil
+		})
+	}()
+	assert.Nil(t, <-refreshed)
+	deleted, err := cache.DeleteIfVersion(ctx, "dish", "49", read)
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	content, _ := cache.rdb.Get(ctx, k).Result()
+	assert.Equal(t, toJson(&Dish{ID: 49, Name: "second"}), content)
+	_, ok := cache.c.Get(k)
+	assert.True(t, ok)
+
+	deleted, err = cache.DeleteIfVersion(ctx, "dish", "49", read+1)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k, cache.VersionKey("dish", "49")).Val())
+	_, ok = cache.c.Get(k)
+	assert.False(t, ok)
+}
@@ -0,0 +1,49 @@
+package levelcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// Encryptor encrypts the serialized values before they are stored and decrypts them when read
+type Encryptor interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+type aesEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewAESEncryptor returns an Encryptor using AES-GCM with key, which must be 16, 24 or 32 bytes long
+// to select AES-128, AES-192 or AES-256. Every value gets a random nonce stored ahead of its ciphertext.
+func NewAESEncryptor(key []byte) (Encryptor, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesEncryptor{aead: aead}, nil
+}
+
+func (p *aesEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize(), p.aead.NonceSize()+len(plaintext)+p.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (p *aesEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < p.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:p.aead.NonceSize()], ciphertext[p.aead.NonceSize():]
+	return p.aead.Open(nil, nonce, sealed, nil)
+}
@@ -0,0 +1,65 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLevelCache_Encryptor(t *testing.T) {
+	_, err := NewAESEncryptor([]byte("short"))
+	assert.NotNil(t, err)
+	enc, err := NewAESEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Errorf("init encryptor fail:%+v", err)
+		return
+	}
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		Encryptor:     enc,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	secret := &Dish{ID: 51, Name: "secret recipe", Comment: strings.Repeat("spicy", 100)}
+	assert.Nil(t, cache.Set(ctx, secret))
+
+	entry, err := cache.rdb.Get(ctx, cache.DataKey("dish", "51")).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xFF, EnvelopeVersion, byte(FlagEncrypted)}, []byte(entry[:3]))
+	assert.NotContains(t, entry, "secret recipe")
+	_, err = DecodeEnvelope([]byte(entry))
+	assert.True(t, errors.Is(err, ErrInvalidEnvelope))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "51", &dish, SkipLocal()))
+	assert.Equal(t, *secret, dish)
+	dish = Dish{}
+	assert.Nil(t, cache.Get(ctx, "51", &dish))
+	assert.Equal(t, *secret, dish)
+
+	// compressed payloads are encrypted once compressed
+	compressed, err := encodeEnvelope(Envelope{Flags: FlagCompressed, Payload: []byte(toJson(secret))}, enc)
+	assert.Nil(t, err)
+	assert.True(t, len(compressed) < len(toJson(secret)))
+	decoded, err := decodeEnvelope(compressed, enc)
+	assert.Nil(t, err)
+	assert.Equal(t, FlagCompressed|FlagEncrypted, decoded.Flags)
+	assert.Equal(t, toJson(secret), string(decoded.Payload))
+
+	// without the key the value can not be read
+	plain, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.True(t, errors.Is(plain.Get(ctx, "51", &dish), ErrInvalidEnvelope))
+}
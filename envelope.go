@@ -0,0 +1,217 @@
+package levelcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// A value stored in redis is either bare JSON, which is what the cache writes for plain JSON values,
+// or an envelope made of
+//
+//	byte 0    envelopeMagic (0xFF), never the first byte of JSON
+//	byte 1    EnvelopeVersion
+//	byte 2    EnvelopeFlags
+//	byte 3    the ID of the Serializer of the payload, only present with FlagSerializer
+//	then      the schema version of the payload as an unsigned varint, only present with FlagSchema
+//	then      payload, gzip compressed when FlagCompressed is set then encrypted when FlagEncrypted is set,
+//	          empty for a tombstone
+//
+// Consumers in other languages parse an entry by checking its first byte and following the layout above.
+const (
+	envelopeMagic byte = 0xFF
+	// EnvelopeVersion is the layout version written by Encode
+	EnvelopeVersion byte = 1
+	envelopeHeader       = 3
+)
+
+// EnvelopeFlags describe the payload of an envelope
+type EnvelopeFlags byte
+
+const (
+	// FlagCompressed marks a gzip compressed payload
+	FlagCompressed EnvelopeFlags = 1 << iota
+	// FlagTombstone marks a deleted value, it has no payload
+	FlagTombstone
+	// FlagSerializer marks a payload produced by another Serializer than JSON, its ID follows the flags
+	FlagSerializer
+	// FlagEncrypted marks a payload encrypted by the Encryptor of the cache
+	FlagEncrypted
+	// FlagSchema marks a payload written with a schema version, which follows the serializer ID
+	FlagSchema
+
+	knownFlags = FlagCompressed | FlagTombstone | FlagSerializer | FlagEncrypted | FlagSchema
+)
+
+// ErrInvalidEnvelope reports an entry which is neither bare JSON nor a valid envelope
+var ErrInvalidEnvelope = errors.New("invalid envelope")
+
+// Envelope is the parsed form of an entry
+type Envelope struct {
+	Flags EnvelopeFlags
+	// Serializer is the ID of the Serializer of Payload, zero for JSON
+	Serializer byte
+	// Schema is the schema version of the namespace Payload was written with, zero when none was set
+	Schema  int
+	Payload []byte
+}
+
+// Encode wraps payload into an entry with flags, a plain payload without flags stays bare.
+func Encode(payload []byte, flags EnvelopeFlags) ([]byte, error) {
+	return EncodeEnvelope(Envelope{Flags: flags, Payload: payload})
+}
+
+// EncodeEnvelope is Encode for payloads of any Serializer, FlagSerializer is set for serializers other than JSON
+// and FlagSchema for a non zero Schema.
+// FlagEncrypted is rejected, only the cache holds the Encryptor.
+func EncodeEnvelope(e Envelope) ([]byte, error) {
+	return encodeEnvelope(e, nil)
+}
+
+// encodeEnvelope encodes e, encrypting its payload with enc when it is not nil
+func encodeEnvelope(e Envelope, enc Encryptor) ([]byte, error) {
+	if enc != nil {
+		e.Flags |= FlagEncrypted
+	} else if e.Flags&FlagEncrypted != 0 {
+		return nil, fmt.Errorf("no encryptor: %w", ErrInvalidEnvelope)
+	}
+	if e.Flags&^knownFlags != 0 {
+		return nil, fmt.Errorf("flags %#x: %w", byte(e.Flags), ErrInvalidEnvelope)
+	}
+	if e.Serializer != 0 {
+		e.Flags |= FlagSerializer
+	}
+	if e.Schema < 0 {
+		return nil, fmt.Errorf("schema %d: %w", e.Schema, ErrInvalidEnvelope)
+	}
+	if e.Schema != 0 {
+		e.Flags |= FlagSchema
+	}
+	if e.Flags == 0 {
+		return e.Payload, nil
+	}
+	entry := []byte{envelopeMagic, EnvelopeVersion, byte(e.Flags)}
+	if e.Flags&FlagSerializer != 0 {
+		entry = append(entry, e.Serializer)
+	}
+	if e.Flags&FlagSchema != 0 {
+		var schema [binary.MaxVarintLen64]byte
+		entry = append(entry, schema[:binary.PutUvarint(schema[:], uint64(e.Schema))]...)
+	}
+	if e.Flags&FlagTombstone != 0 {
+		return entry, nil
+	}
+	payload := e.Payload
+	if e.Flags&FlagCompressed != 0 {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		payload = buf.Bytes()
+	}
+	if enc != nil {
+		var err error
+		if payload, err = enc.Encrypt(payload); err != nil {
+			return nil, err
+		}
+	}
+	return append(entry, payload...), nil
+}
+
+// Decode parses an entry read from redis into its payload and flags,
+// bare JSON entries are returned as they are without flags.
+func Decode(entry []byte) ([]byte, EnvelopeFlags, error) {
+	e, err := DecodeEnvelope(entry)
+	return e.Payload, e.Flags, err
+}
+
+// DecodeEnvelope is Decode also returning the Serializer ID of the payload.
+// Encrypted entries are rejected, only the cache holds the Encryptor.
+func DecodeEnvelope(entry []byte) (Envelope, error) {
+	return decodeEnvelope(entry, nil)
+}
+
+// decodeEnvelope decodes entry, decrypting its payload with enc
+func decodeEnvelope(entry []byte, enc Encryptor) (Envelope, error) {
+	if len(entry) == 0 || entry[0] != envelopeMagic {
+		return Envelope{Payload: entry}, nil
+	}
+	if len(entry) < envelopeHeader {
+		return Envelope{}, fmt.Errorf("truncated header: %w", ErrInvalidEnvelope)
+	}
+	if entry[1] != EnvelopeVersion {
+		return Envelope{}, fmt.Errorf("version %d: %w", entry[1], ErrInvalidEnvelope)
+	}
+	e := Envelope{Flags: EnvelopeFlags(entry[2])}
+	if unknown := e.Flags &^ knownFlags; unknown != 0 {
+		// e.g. a codec added by a newer release, still rolling out
+		return Envelope{}, fmt.Errorf("unknown flags %#x, written by a newer version: %w", byte(unknown), ErrInvalidEnvelope)
+	}
+	payload := entry[envelopeHeader:]
+	if e.Flags&FlagSerializer != 0 {
+		if len(payload) == 0 {
+			return Envelope{}, fmt.Errorf("truncated header: %w", ErrInvalidEnvelope)
+		}
+		e.Serializer, payload = payload[0], payload[1:]
+	}
+	if e.Flags&FlagSchema != 0 {
+		schema, n := binary.Uvarint(payload)
+		if n <= 0 || schema > math.MaxInt32 {
+			return Envelope{}, fmt.Errorf("truncated header: %w", ErrInvalidEnvelope)
+		}
+		e.Schema, payload = int(schema), payload[n:]
+	}
+	if e.Flags&FlagTombstone != 0 {
+		return e, nil
+	}
+	if e.Flags&FlagEncrypted != 0 {
+		if enc == nil {
+			return Envelope{}, fmt.Errorf("no encryptor: %w", ErrInvalidEnvelope)
+		}
+		var err error
+		if payload, err = enc.Decrypt(payload); err != nil {
+			return Envelope{}, fmt.Errorf("%v: %w", err, ErrInvalidEnvelope)
+		}
+	}
+	if e.Flags&FlagCompressed != 0 {
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%v: %w", err, ErrInvalidEnvelope)
+		}
+		if payload, err = ioutil.ReadAll(r); err != nil {
+			return Envelope{}, fmt.Errorf("%v: %w", err, ErrInvalidEnvelope)
+		}
+	}
+	e.Payload = payload
+	return e, nil
+}
+
+// decodeEntry decodes a redis entry into its payload with the encryptor enc, a tombstone reads as redis.Nil
+func decodeEntry(entry string, enc Encryptor) (string, error) {
+	e, err := decodeEnvelope([]byte(entry), enc)
+	if err != nil {
+		return "", err
+	}
+	if e.Flags&FlagTombstone != 0 {
+		return "", redis.Nil
+	}
+	return string(e.Payload), nil
+}
+
+// liveEntry returns entry unless it is a tombstone, which reads as redis.Nil
+func liveEntry(entry string) (string, error) {
+	if len(entry) > 2 && entry[0] == envelopeMagic && EnvelopeFlags(entry[2])&FlagTombstone != 0 {
+		return "", redis.Nil
+	}
+	return entry, nil
+}
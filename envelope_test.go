@@ -0,0 +1,106 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	payload := []byte(toJson(&Dish{ID: 1, Comment: strings.Repeat("awesome", 100)}))
+
+	plain, err := Encode(payload, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, plain)
+	decoded, flags, err := Decode(plain)
+	assert.Nil(t, err)
+	assert.Equal(t, EnvelopeFlags(0), flags)
+	assert.Equal(t, payload, decoded)
+
+	compressed, err := Encode(payload, FlagCompressed)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xFF, EnvelopeVersion, byte(FlagCompressed)}, compressed[:3])
+	assert.True(t, len(compressed) < len(payload))
+	decoded, flags, err = Decode(compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, FlagCompressed, flags)
+	assert.Equal(t, payload, decoded)
+
+	tombstone, err := Encode(payload, FlagTombstone)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xFF, EnvelopeVersion, byte(FlagTombstone)}, tombstone)
+	decoded, flags, err = Decode(tombstone)
+	assert.Nil(t, err)
+	assert.Equal(t, FlagTombstone, flags)
+	assert.Empty(t, decoded)
+
+	_, _, err = Decode([]byte{0xFF, 9, 0})
+	assert.True(t, errors.Is(err, ErrInvalidEnvelope))
+	_, _, err = Decode([]byte{0xFF, EnvelopeVersion, byte(FlagCompressed), 'x'})
+	assert.True(t, errors.Is(err, ErrInvalidEnvelope))
+	_, err = Encode(payload, 1<<7)
+	assert.True(t, errors.Is(err, ErrInvalidEnvelope))
+}
+
+func TestLevelCache_GetEnvelope(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return &Dish{ID: 12, Name: "loaded"}, nil
+	})
+	k := cache.cacheKey("dish", "12")
+	entry, _ := Encode([]byte(toJson(&Dish{ID: 12, Name: "compressed"})), FlagCompressed)
+	cache.rdb.Set(context.TODO(), k, entry, 0)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "12", &dish, SkipLocal()))
+	assert.Equal(t, "compressed", dish.Name)
+	assert.Equal(t, 0, loads)
+
+	entry, _ = Encode(nil, FlagTombstone)
+	cache.rdb.Set(context.TODO(), k, entry, 0)
+	assert.Nil(t, cache.Get(context.TODO(), "12", &dish, SkipLocal()))
+	assert.Equal(t, "loaded", dish.Name)
+	assert.Equal(t, 1, loads)
+}
+
+func TestLevelCache_GetMixedEnvelopes(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	payload := func(id int) []byte {
+		return []byte(toJson(&Dish{ID: id, Name: "mixed"}))
+	}
+	compressed, _ := Encode(payload(55), FlagCompressed)
+	cache.rdb.Set(ctx, cache.cacheKey("dish", "54"), payload(54), 0)
+	cache.rdb.Set(ctx, cache.cacheKey("dish", "55"), compressed, 0)
+	// written by a release compressing with a codec this one does not know
+	cache.rdb.Set(ctx, cache.cacheKey("dish", "56"), append([]byte{0xFF, EnvelopeVersion, 1 << 7}, payload(56)...), 0)
+
+	for _, id := range []int{54, 55} {
+		var dish Dish
+		assert.Nil(t, cache.Get(ctx, strconv.Itoa(id), &dish, SkipLocal()))
+		assert.Equal(t, Dish{ID: id, Name: "mixed"}, dish)
+	}
+	var dish Dish
+	err = cache.Get(ctx, "56", &dish, SkipLocal())
+	assert.True(t, errors.Is(err, ErrInvalidEnvelope))
+	assert.Contains(t, err.Error(), "unknown flags 0x80")
+}
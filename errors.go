@@ -0,0 +1,112 @@
+package levelcache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNamespaceMismatch reports an object used with a namespace other than its own,
+	// typically a loader registered under the wrong namespace.
+	ErrNamespaceMismatch = errors.New("namespace mismatch")
+	// ErrValueTooLarge reports a serialized value exceeding MaxValueBytes, which is never cached.
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrRedisDisabled is returned by the methods needing redis on a cache created by NewLocalOnly.
+	ErrRedisDisabled = errors.New("redis disabled")
+	// ErrNilObject reports a nil object, or a non pointer one passed to be filled by a Get.
+	ErrNilObject = errors.New("nil object")
+	// ErrTypeMismatch reports an object of another type than the one given to RegisterTypedLoader.
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrVersioningDisabled is returned by the version based methods for namespaces without versioning.
+	ErrVersioningDisabled = errors.New("versioning disabled")
+	// ErrHashStorageDisabled is returned by ClearNamespace for namespaces storing their values as strings.
+	ErrHashStorageDisabled = errors.New("hash storage disabled")
+	// ErrRedisWritesSuspended is returned by the conditional writes of a namespace over its SetRedisMemoryLimit.
+	ErrRedisWritesSuspended = errors.New("redis writes suspended")
+	// ErrNotFound reports a missing value, loaders wrap it for keys without data
+	// so that Get can serve the WithDefault object instead.
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyStarted is returned by Start once the background worker was started.
+	ErrAlreadyStarted = errors.New("already started")
+	// ErrReservedNamespace reports a loader registered for a namespace named like the internal keys.
+	ErrReservedNamespace = errors.New("reserved namespace")
+	// ErrClosed is returned by the writes Close can no longer wait for, such as the coalesced ones.
+	ErrClosed = errors.New("closed")
+)
+
+// LoaderError wraps the failure of a loader with the namespace and key it was loading,
+// Key is empty when a BatchDataLoader failed as a whole.
+type LoaderError struct {
+	Namespace string
+	Key       string
+	Err       error
+}
+
+func (e LoaderError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("batch loader [%s] fail: %v", e.Namespace, e.Err)
+	}
+	return fmt.Sprintf("data loader [%s] key [%s] fail: %v", e.Namespace, e.Key, e.Err)
+}
+
+func (e LoaderError) Unwrap() error {
+	return e.Err
+}
+
+// LoaderPanicError is the error of a loader which panicked, wrapped in a LoaderError.
+// Value is the value recovered and Stack the stack of the loader when it panicked.
+type LoaderPanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e LoaderPanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value recovered when it is an error
+func (e LoaderPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MultiError reports the keys that failed in an operation on many keys, the other keys succeeded.
+// It is only returned when at least one key failed.
+type MultiError struct {
+	op   string
+	errs map[string]error
+}
+
+// Errors returns the failure of each failed key
+func (e MultiError) Errors() map[string]error {
+	return e.errs
+}
+
+func (e MultiError) Error() string {
+	failed := make([]string, 0, len(e.errs))
+	for key, err := range e.errs {
+		failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+	}
+	sort.Strings(failed)
+	return fmt.Sprintf("%s fail: %s", e.op, strings.Join(failed, "; "))
+}
+
+// Is reports whether the failure of any key matches target, e.g. ErrNotFound
+func (e MultiError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiError returns the MultiError of op for errs, nil when no key failed
+func multiError(op string, errs map[string]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return MultiError{op: op, errs: errs}
+}
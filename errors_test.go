@@ -0,0 +1,116 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_LoaderError(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	storeDown := errors.New("dish store down")
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return nil, storeDown
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "14"))
+
+	var dish Dish
+	err = cache.Get(context.TODO(), "14", &dish)
+	var loaderErr LoaderError
+	assert.True(t, errors.As(err, &loaderErr))
+	assert.Equal(t, "dish", loaderErr.Namespace)
+	assert.Equal(t, "14", loaderErr.Key)
+	assert.True(t, errors.Is(err, storeDown))
+
+	err = cache.refresh(context.TODO(), "dish", "15", func() (Cacheable, time.Duration, error) {
+		return cache.load(context.TODO(), "dish", "15", cache.loaders["dish"])
+	})
+	assert.True(t, errors.As(err, &loaderErr))
+	assert.Equal(t, "15", loaderErr.Key)
+
+	_ = cache.RegisterBatchLoader("dish", func(ctx context.Context, keys []string) (map[string]Cacheable, error) {
+		return nil, storeDown
+	})
+	_, err = cache.fetcher(context.TODO(), "dish", []string{"16"})
+	assert.True(t, errors.As(err, &loaderErr))
+	assert.Equal(t, LoaderError{Namespace: "dish", Err: storeDown}, loaderErr)
+}
+
+func TestLevelCache_NilObject(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+
+	var nilDish *Dish
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "1", nil), ErrNilObject))
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "1", nilDish), ErrNilObject))
+	_, err = cache.GetWithTTL(context.TODO(), "1", nilDish)
+	assert.True(t, errors.Is(err, ErrNilObject))
+	assert.True(t, errors.Is(cache.Set(context.TODO(), nil), ErrNilObject))
+	assert.True(t, errors.Is(cache.Set(context.TODO(), nilDish), ErrNilObject))
+	_, err = cache.SetIfVersion(context.TODO(), nilDish, 0)
+	assert.True(t, errors.Is(err, ErrNilObject))
+	assert.NotPanics(t, func() {
+		cache.SetAsync(context.TODO(), nilDish)
+	})
+}
+
+func TestLevelCache_MultiError(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	storeDown := errors.New("dish store down")
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if key == "72" {
+			return nil, storeDown
+		}
+		id, _ := strconv.Atoi(key)
+		return &Dish{ID: id, Name: "refreshed"}, nil
+	})
+	keys := []string{"71", "72", "73"}
+	for _, key := range keys {
+		cache.rdb.Del(context.TODO(), cache.cacheKey("dish", key))
+	}
+
+	err = cache.RefreshMany(context.TODO(), "dish", keys)
+	var multiErr MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.Len(t, multiErr.Errors(), 1)
+	assert.True(t, errors.Is(multiErr.Errors()["72"], storeDown))
+	assert.True(t, errors.Is(err, storeDown))
+	for _, key := range []string{"71", "73"} {
+		var dish Dish
+		src, err := cache.GetWithSource(context.TODO(), key, &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceLocal, src)
+		assert.Equal(t, "refreshed", dish.Name)
+	}
+
+	err = cache.MSet(context.TODO(), []Cacheable{&Dish{ID: 71}, nil, &Dish{ID: 73}})
+	assert.True(t, errors.As(err, &multiErr))
+	assert.Len(t, multiErr.Errors(), 1)
+	assert.True(t, errors.Is(multiErr.Errors()["#1"], ErrNilObject))
+	assert.True(t, errors.Is(err, ErrNilObject))
+	assert.Nil(t, cache.MSet(context.TODO(), []Cacheable{&Dish{ID: 71}}))
+}
@@ -0,0 +1,84 @@
+package levelcache
+
+import "sync"
+
+// EventType tells what happened to the value of a CacheEvent
+type EventType int
+
+const (
+	// EventSet reports a value written by Set, SetIfVersion, SetAsync or MSet
+	EventSet EventType = iota + 1
+	// EventDelete reports a value removed by Delete, DeleteIfVersion or DeleteByPattern
+	EventDelete
+	// EventRefresh reports a value reloaded by Refresh or RefreshMany
+	EventRefresh
+	// EventInvalidate reports a local entry dropped because another instance changed its value
+	EventInvalidate
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventRefresh:
+		return "refresh"
+	case EventInvalidate:
+		return "invalidate"
+	default:
+		return "unknown"
+	}
+}
+
+// CacheEvent is a change of a value made through this cache instance, or observed by it for EventInvalidate
+type CacheEvent struct {
+	Type      EventType
+	Namespace string
+	Key       string
+}
+
+// eventStream holds the channel returned by Events, created on the first call so that no event is buffered
+// or dropped when nobody listens
+type eventStream struct {
+	mu     sync.RWMutex
+	ch     chan CacheEvent
+	closed bool
+}
+
+// Events returns the channel of the changes made through the cache from now on, shared by all callers.
+// Up to MaxEventBuffer events wait for a slow consumer, further ones are dropped and counted in Stats,
+// the cache never blocks on it. The channel is closed by Close.
+func (p *LevelCache) Events() <-chan CacheEvent {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	if p.events.ch == nil {
+		p.events.ch = make(chan CacheEvent, p.cfg.MaxEventBuffer)
+		if p.events.closed {
+			close(p.events.ch)
+		}
+	}
+	return p.events.ch
+}
+
+func (p *LevelCache) emit(t EventType, namespace, key string) {
+	p.events.mu.RLock()
+	defer p.events.mu.RUnlock()
+	if p.events.ch == nil || p.events.closed {
+		return
+	}
+	select {
+	case p.events.ch <- CacheEvent{Type: t, Namespace: namespace, Key: key}:
+	default:
+		p.stats.dropEvent()
+	}
+}
+
+func (p *LevelCache) closeEvents() {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	if !p.events.closed && p.events.ch != nil {
+		close(p.events.ch)
+	}
+	p.events.closed = true
+}
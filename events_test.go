@@ -0,0 +1,82 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_Events(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	other, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	_ = cache.RegisterLoader("dish", GetDish)
+	assert.Nil(t, cache.Start(ctx))
+	events := cache.Events()
+
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 62}))
+	assert.Nil(t, cache.Refresh(ctx, "dish", "1").Wait(ctx))
+	version, _ := cache.currentVersion(ctx, "dish", "62")
+	deleted, err := cache.DeleteIfVersion(ctx, "dish", "62", version)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	// another instance changes a value cached here, the worker drops the local copy
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 63}))
+	assert.Nil(t, other.Set(ctx, &Dish{ID: 63, Name: "changed"}))
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "63", &dish))
+
+	want := []CacheEvent{
+		{Type: EventSet, Namespace: "dish", Key: "62"},
+		{Type: EventRefresh, Namespace: "dish", Key: "1"},
+		{Type: EventDelete, Namespace: "dish", Key: "62"},
+		{Type: EventSet, Namespace: "dish", Key: "63"},
+		{Type: EventInvalidate, Namespace: "dish", Key: "63"},
+	}
+	for _, w := range want {
+		select {
+		case e := <-events:
+			assert.Equal(t, w, e, e.Type.String())
+		case <-time.After(time.Second):
+			t.Fatalf("missing %s event", w.Type)
+		}
+	}
+	assert.Nil(t, cache.Close())
+	_, open := <-events
+	assert.False(t, open)
+}
+
+func TestLevelCache_EventsDropped(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:      "localhost:6379",
+		RedisPoolSize:  10,
+		MaxEventBuffer: 1,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	// nothing is buffered nor dropped before Events is called
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 62}))
+	events := cache.Events()
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 62}))
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 63}))
+	assert.Equal(t, uint64(1), cache.Stats().DroppedEvents)
+	assert.Equal(t, "62", (<-events).Key)
+}
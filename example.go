@@ -41,6 +41,6 @@ func GetDish(ctx context.Context, key string) (Cacheable, error) {
 			Comment: "excellent",
 		}, nil
 	default:
-		return nil, fmt.Errorf("dish [%s] not found", key)
+		return nil, fmt.Errorf("dish [%s] %w", key, ErrNotFound)
 	}
 }
@@ -0,0 +1,73 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// GetMany reads keys of the namespace into objects built by newObj, returning them by key.
+// Keys missing from both levels are loaded at once by the BatchDataLoader when one is registered and one by one
+// by the DataLoader otherwise, keys found nowhere are omitted from the map. The keys that failed are reported
+// by a MultiError, or the error of the BatchDataLoader when it failed as a whole, along with the objects read.
+func (p *LevelCache) GetMany(ctx context.Context, namespace string, keys []string, newObj func() Cacheable) (map[string]Cacheable, error) {
+	if newObj == nil {
+		return nil, fmt.Errorf("%w: nil newObj", ErrNilObject)
+	}
+	var (
+		objs   = make(map[string]Cacheable, len(keys))
+		errs   = make(map[string]error)
+		seen   = make(map[string]bool, len(keys))
+		misses []string
+	)
+	get := func(key string, o getOptions) (Source, Cacheable, error) {
+		obj := newObj()
+		if err := checkObject(obj, true); err != nil {
+			return SourceNone, nil, err
+		}
+		if obj.Namespace() != namespace {
+			return SourceNone, nil, fmt.Errorf("%w: GetMany of [%s] got [%s] object", ErrNamespaceMismatch, namespace, obj.Namespace())
+		}
+		src, err := p.get(ctx, key, obj, o)
+		return src, obj, err
+	}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		p.checkCacheUpdate(ctx, namespace, key)
+		src, obj, err := get(key, getOptions{cachedOnly: true})
+		switch {
+		case err != nil:
+			errs[key] = err
+		case src == SourceNone:
+			misses = append(misses, key)
+		default:
+			objs[key] = obj
+		}
+	}
+	if len(misses) == 0 {
+		return objs, multiError(fmt.Sprintf("get [%s]", namespace), errs)
+	}
+
+	fetch, err := p.fetcher(ctx, namespace, misses)
+	if errors.Is(err, ErrNotFound) {
+		return objs, multiError(fmt.Sprintf("get [%s]", namespace), errs)
+	}
+	if err != nil {
+		return objs, err
+	}
+	for _, key := range misses {
+		// read through again, the key may have been cached meanwhile
+		_, obj, err := get(key, getOptions{fetch: fetch})
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			errs[key] = err
+		default:
+			objs[key] = obj
+		}
+	}
+	return objs, multiError(fmt.Sprintf("get [%s]", namespace), errs)
+}
@@ -0,0 +1,49 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_GetMany(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	var calls [][]string
+	_ = cache.RegisterBatchLoader("dish", func(ctx context.Context, keys []string) (map[string]Cacheable, error) {
+		calls = append(calls, keys)
+		data := make(map[string]Cacheable)
+		for _, key := range keys {
+			if dish, err := GetDish(ctx, key); err == nil {
+				data[key] = dish
+			}
+		}
+		return data, nil
+	})
+	ctx := context.TODO()
+	cache.rdb.Del(ctx, cache.cacheKey("dish", "2"), cache.cacheKey("dish", "missing"))
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "1", &dish))
+
+	newDish := func() Cacheable { return &Dish{} }
+	dishes, err := cache.GetMany(ctx, "dish", []string{"1", "2", "missing"}, newDish)
+	assert.Nil(t, err)
+	assert.Len(t, dishes, 2)
+	assert.Equal(t, 1, dishes["1"].(*Dish).ID)
+	assert.Equal(t, 2, dishes["2"].(*Dish).ID)
+	// only the keys missing from both levels are loaded
+	assert.Equal(t, [][]string{{"2", "missing"}}, calls)
+
+	_, err = cache.GetMany(ctx, "drink", []string{"1"}, newDish)
+	assert.True(t, errors.Is(err, ErrNamespaceMismatch))
+	_, err = cache.GetMany(ctx, "dish", []string{"1"}, nil)
+	assert.True(t, errors.Is(err, ErrNilObject))
+}
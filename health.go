@@ -0,0 +1,41 @@
+package levelcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// HealthStatus is a snapshot of the cache and its dependencies for readiness probes
+type HealthStatus struct {
+	RedisReachable bool
+	RedisError     string
+	// Degraded tells that the last version check failed under DegradeOnVersionError,
+	// local hits may then be stale
+	Degraded      bool
+	Loaders       int
+	WorkerRunning bool
+}
+
+// Ping returns an error when redis is unreachable.
+func (p *LevelCache) Ping(ctx context.Context) error {
+	if p.localOnly() {
+		return ErrRedisDisabled
+	}
+	return p.rdb.Ping(ctx).Err()
+}
+
+// Health reports redis reachability, the number of registered loaders and whether the Start worker is alive.
+func (p *LevelCache) Health(ctx context.Context) HealthStatus {
+	var status HealthStatus
+	if err := p.Ping(ctx); err != nil {
+		status.RedisError = err.Error()
+	} else {
+		status.RedisReachable = true
+	}
+	status.Degraded = atomic.LoadInt32(&p.degraded) == 1
+	status.Loaders = len(p.Namespaces())
+	p.wmu.RLock()
+	status.WorkerRunning = p.running
+	p.wmu.RUnlock()
+	return status
+}
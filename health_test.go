@@ -0,0 +1,32 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_Health(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	assert.Nil(t, cache.Ping(context.TODO()))
+	assert.Equal(t, HealthStatus{RedisReachable: true, Loaders: 1}, cache.Health(context.TODO()))
+
+	cache.Start(context.Background())
+	assert.True(t, cache.Health(context.TODO()).WorkerRunning)
+	cache.Stop()
+	assert.False(t, cache.Health(context.TODO()).WorkerRunning)
+
+	_ = cache.rdb.Close()
+	assert.NotNil(t, cache.Ping(context.TODO()))
+	status := cache.Health(context.TODO())
+	assert.False(t, status.RedisReachable)
+	assert.NotEmpty(t, status.RedisError)
+}
@@ -0,0 +1,100 @@
+package levelcache
+
+import (
+	"context"
+	"log"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Logger receives the warnings of the cache, *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Hooks are optional callbacks invoked by the cache, nil hooks are skipped
+type Hooks struct {
+	// OnLoaderComplete is called after every DataLoader invocation with its duration
+	OnLoaderComplete func(namespace, key string, d time.Duration)
+	// OnSlowLoader is called when a DataLoader takes longer than SlowLoaderThreshold
+	OnSlowLoader func(namespace, key string, d time.Duration)
+	// OnLockWait is called once a reload lock is acquired, or given up when the context is done,
+	// with the time waited and the failed attempts
+	OnLockWait func(namespace, key string, wait time.Duration, failures int, acquired bool)
+	// OnWorkerPanic is called with the value recovered from a panicking task of the Start worker,
+	// the worker goes on with the next task
+	OnWorkerPanic func(task string, v interface{})
+	// OnLoaderFallback is called when the loader at index of a RegisterLoaderChain served a value
+	// after the loaders before it failed with errs
+	OnLoaderFallback func(namespace, key string, index int, errs []error)
+	// OnVersionCheckError is called when reading the version of a local hit fails on redis,
+	// a missing version is not an error
+	OnVersionCheckError func(namespace, key string, err error)
+}
+
+var defaultLogger Logger = log.New(os.Stderr, "[levelcache] ", log.LstdFlags)
+
+// load invokes the loader within the concurrency limit of the namespace and reports its duration through hooks and logger
+func (p *LevelCache) load(ctx context.Context, namespace, key string, loader DataLoaderWithTTL) (Cacheable, time.Duration, error) {
+	if slots := p.namespaceConfig(namespace).loadSlots; slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() {
+				<-slots
+			}()
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+	start := p.cfg.Clock.Now()
+	data, ttl, err := p.callLoader(ctx, namespace, key, loader)
+	d := p.cfg.Clock.Now().Sub(start)
+	p.stats.recordLoader(d)
+
+	if p.cfg.Hooks.OnLoaderComplete != nil {
+		p.cfg.Hooks.OnLoaderComplete(namespace, key, d)
+	}
+	if p.cfg.SlowLoaderThreshold > 0 && d > p.cfg.SlowLoaderThreshold {
+		p.cfg.Logger.Printf("slow data loader [%s] key [%s] took %s", namespace, key, d)
+		if p.cfg.Hooks.OnSlowLoader != nil {
+			p.cfg.Hooks.OnSlowLoader(namespace, key, d)
+		}
+	}
+	if err != nil {
+		return nil, 0, LoaderError{Namespace: namespace, Key: key, Err: err}
+	}
+	if err := checkNamespace(namespace, key, data); err != nil {
+		return nil, 0, err
+	}
+	if err := p.checkType(namespace, data); err != nil {
+		return nil, 0, err
+	}
+	return data, ttl, p.validate(namespace, key, data)
+}
+
+// callLoader invokes loader, a panic of the loader being returned as a LoaderPanicError
+func (p *LevelCache) callLoader(ctx context.Context, namespace, key string, loader DataLoaderWithTTL) (data Cacheable, ttl time.Duration, err error) {
+	defer p.recoverLoader(namespace, key, &err)
+	if middlewares := p.loaderMiddlewares(); len(middlewares) > 0 {
+		data, err = wrapLoader(loader, &ttl, middlewares)(ctx, key)
+		return data, ttl, err
+	}
+	return loader(ctx, key)
+}
+
+// callBatchLoader invokes a BatchDataLoader like callLoader
+func (p *LevelCache) callBatchLoader(ctx context.Context, namespace string, keys []string, loader BatchDataLoader) (data map[string]Cacheable, err error) {
+	defer p.recoverLoader(namespace, "", &err)
+	return loader(ctx, keys)
+}
+
+// recoverLoader is deferred around loader calls to turn a panic into a LoaderPanicError stored in err,
+// logging it with its stack
+func (p *LevelCache) recoverLoader(namespace, key string, err *error) {
+	if r := recover(); r != nil {
+		stack := debug.Stack()
+		p.cfg.Logger.Printf("data loader [%s] key [%s] panic: %v\n%s", namespace, key, r, stack)
+		*err = LoaderPanicError{Value: r, Stack: stack}
+	}
+}
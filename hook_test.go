@@ -0,0 +1,276 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordLogger []string
+
+func (p *recordLogger) Printf(format string, v ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, v...))
+}
+
+func TestLevelCache_SlowLoader(t *testing.T) {
+	var (
+		logger    recordLogger
+		completed time.Duration
+		slowKeys  []string
+	)
+	cache, err := New(CacheConfig{
+		RedisAddr:           "localhost:6379",
+		RedisPoolSize:       10,
+		SlowLoaderThreshold: 10 * time.Millisecond,
+		Logger:              &logger,
+		Hooks: Hooks{
+			OnLoaderComplete: func(namespace, key string, d time.Duration) {
+				completed = d
+			},
+			OnSlowLoader: func(namespace, key string, d time.Duration) {
+				slowKeys = append(slowKeys, jointKey(namespace, key))
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		time.Sleep(20 * time.Millisecond)
+		return &Dish{ID: 3, Name: "slow"}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "slow"))
+
+	var dish Dish
+	if err := cache.Get(context.TODO(), "slow", &dish); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.True(t, completed >= 20*time.Millisecond)
+	assert.Equal(t, []string{jointKey("dish", "slow")}, slowKeys)
+	assert.Len(t, logger, 1)
+}
+
+type tenantKey struct{}
+
+func TestLevelCache_LoaderContext(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	tenants := make(chan interface{}, 2)
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		tenants <- ctx.Value(tenantKey{})
+		return &Dish{ID: 13}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "13"))
+	ctx := context.WithValue(context.Background(), tenantKey{}, "tenant-a")
+
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "13", &dish))
+	assert.Equal(t, "tenant-a", <-tenants)
+
+	cache.Refresh(context.WithValue(context.Background(), tenantKey{}, "tenant-b"), "dish", "13")
+	select {
+	case tenant := <-tenants:
+		assert.Equal(t, "tenant-b", tenant)
+	case <-time.After(time.Second):
+		t.Errorf("refresh did not call the loader")
+	}
+}
+
+// panicHook panics on every GET of key, like a bug hit while processing one update
+type panicHook struct {
+	key string
+}
+
+func (p *panicHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "get" && len(cmd.Args()) > 1 && cmd.Args()[1] == p.key {
+		panic("bad update")
+	}
+	return ctx, nil
+}
+
+func (p *panicHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (p *panicHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (p *panicHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_WorkerPanic(t *testing.T) {
+	panics := make(chan interface{}, 1)
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		Logger:        &recordLogger{},
+		Hooks: Hooks{
+			OnWorkerPanic: func(task string, v interface{}) {
+				panics <- v
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	bad, good := cache.cacheKey("dish", "39"), cache.cacheKey("dish", "40")
+	cache.rdb.Set(context.TODO(), good, toJson(&Dish{ID: 40, Name: "updated"}), 0)
+	cache.rdb.AddHook(&panicHook{key: bad})
+	cache.Start(context.Background())
+	defer cache.Stop()
+
+	cache.updates <- versionInfo{dataKey: bad, versionNo: 1}
+	select {
+	case v := <-panics:
+		assert.Equal(t, "bad update", v)
+	case <-time.After(time.Second):
+		t.Errorf("panic not reported")
+		return
+	}
+
+	cache.updates <- versionInfo{dataKey: good, versionNo: 1}
+	assert.Eventually(t, func() bool {
+		_, ok := cache.c.Get(good)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	v, _ := cache.getVersion(good)
+	assert.Equal(t, int64(1), v)
+}
+
+func TestLevelCache_RefreshTimeout(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:      "localhost:6379",
+		RedisPoolSize:  10,
+		RedisOpTimeout: 100 * time.Millisecond,
+		Logger:         &recordLogger{},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	tenants := make(chan interface{}, 1)
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		tenants <- ctx.Value(tenantKey{})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	cache.rdb.Del(context.TODO(), cache.lockKey("dish", "70"))
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "tenant-a"))
+	defer cancel()
+	start := time.Now()
+	h := cache.Refresh(ctx, "dish", "70")
+	select {
+	case tenant := <-tenants:
+		assert.Equal(t, "tenant-a", tenant)
+	case <-time.After(time.Second):
+		t.Errorf("refresh did not call the loader")
+		return
+	}
+	// the request triggering the refresh is over, the refresh goes on until RedisOpTimeout
+	cancel()
+
+	err = h.Wait(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	// the lock was released despite the timeout
+	assert.Equal(t, int64(0), cache.rdb.Exists(context.TODO(), cache.lockKey("dish", "70")).Val())
+}
+
+func TestLevelCache_VersionCheckError(t *testing.T) {
+	var (
+		logger recordLogger
+		failed []string
+	)
+	cache, err := New(CacheConfig{
+		RedisAddr:             "localhost:6379",
+		RedisPoolSize:         10,
+		DegradeOnVersionError: true,
+		Logger:                &logger,
+		Hooks: Hooks{
+			OnVersionCheckError: func(namespace, key string, err error) {
+				failed = append(failed, jointKey(namespace, key))
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 74, Name: "local"}))
+
+	// a missing version is not an error
+	cache.rdb.Del(context.TODO(), cache.versionKey("dish", "74"))
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "74", &dish))
+	assert.Equal(t, "local", dish.Name)
+	assert.Empty(t, logger)
+	assert.Empty(t, failed)
+	assert.Equal(t, uint64(0), cache.Stats().VersionCheckErrors)
+	assert.False(t, cache.Health(context.TODO()).Degraded)
+
+	// the connection fails on the version read, the local copy is served and the failure reported
+	cache.rdb.AddHook(&flakyHook{failures: 1})
+	assert.Nil(t, cache.Get(context.TODO(), "74", &dish))
+	assert.Equal(t, "local", dish.Name)
+	assert.Len(t, logger, 1)
+	assert.Equal(t, []string{jointKey("dish", "74")}, failed)
+	assert.Equal(t, uint64(1), cache.Stats().VersionCheckErrors)
+	assert.True(t, cache.Health(context.TODO()).Degraded)
+
+	// the next successful check leaves the degraded mode
+	assert.Nil(t, cache.Get(context.TODO(), "74", &dish))
+	assert.False(t, cache.Health(context.TODO()).Degraded)
+}
+
+func TestLevelCache_LoaderPanic(t *testing.T) {
+	var logger recordLogger
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		Logger:        &logger,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		var prices map[string]int
+		prices[key] = 83
+		return &Dish{ID: 83}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "83"))
+
+	var dish Dish
+	err = cache.Get(context.TODO(), "83", &dish)
+	var panicErr LoaderPanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Contains(t, fmt.Sprint(panicErr.Value), "nil map")
+	assert.NotEmpty(t, panicErr.Stack)
+	var loaderErr LoaderError
+	assert.True(t, errors.As(err, &loaderErr))
+	assert.Equal(t, "83", loaderErr.Key)
+	assert.Len(t, logger, 1)
+	assert.Contains(t, logger[0], "data loader [dish] key [83] panic")
+
+	_ = cache.RegisterBatchLoader("dish", func(ctx context.Context, keys []string) (map[string]Cacheable, error) {
+		panic(errors.New("batch boom"))
+	})
+	err = cache.RefreshMany(context.TODO(), "dish", []string{"83"})
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "batch boom", errors.Unwrap(panicErr).Error())
+}
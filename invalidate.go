@@ -0,0 +1,49 @@
+package levelcache
+
+// OnInvalidate registers fn to be called whenever a local entry is replaced or evicted because its value changed:
+// when the Start worker applies a newer version, when GetIfChanged drops an outdated copy and when DeleteIfVersion
+// or DeleteByPattern removes the value. With a custom KeyEncoder DeleteByPattern reports the whole key with an empty namespace.
+// Callbacks run on the goroutine making the change, outside of any lock of the cache, and should return quickly.
+func (p *LevelCache) OnInvalidate(fn func(namespace, key string)) {
+	p.imu.Lock()
+	p.invalidations = append(p.invalidations, fn)
+	p.imu.Unlock()
+}
+
+// invalidated runs the OnInvalidate callbacks and reports the change t to Events
+func (p *LevelCache) invalidated(t EventType, namespace, key string) {
+	p.emit(t, namespace, key)
+	p.imu.RLock()
+	callbacks := p.invalidations
+	p.imu.RUnlock()
+	for _, fn := range callbacks {
+		fn(namespace, key)
+	}
+}
+
+// OnLocalEviction registers fn to be called whenever a local entry goes away, with EvictExpired when it was purged
+// once expired, see CleanupInterval, and EvictDeleted when it was removed before, e.g. by DeleteIfVersion.
+// Entries replaced by a newer value or dropped by FlushLocal are not reported. With a custom KeyEncoder
+// the whole key is reported with an empty namespace. Callbacks run outside of any lock of the cache.
+func (p *LevelCache) OnLocalEviction(fn func(namespace, key string, reason EvictReason)) {
+	p.imu.Lock()
+	p.evictions = append(p.evictions, fn)
+	p.imu.Unlock()
+}
+
+// evicted runs the OnLocalEviction callbacks for the local entry k
+func (p *LevelCache) evicted(k string, reason EvictReason) {
+	p.imu.RLock()
+	callbacks := p.evictions
+	p.imu.RUnlock()
+	if len(callbacks) == 0 {
+		return
+	}
+	namespace, key := "", k
+	if parts, ok := p.splitKey(k); ok && len(parts) == 2 {
+		namespace, key = parts[0], parts[1]
+	}
+	for _, fn := range callbacks {
+		fn(namespace, key, reason)
+	}
+}
@@ -0,0 +1,102 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_OnInvalidate(t *testing.T) {
+	writer, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	reader, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	invalidated := make(chan string, 10)
+	reader.OnInvalidate(func(namespace, key string) {
+		invalidated <- jointKey(namespace, key)
+	})
+	ctx := context.TODO()
+	_ = reader.RegisterLoader("dish", GetDish)
+	reader.Start(context.Background())
+	defer reader.Stop()
+	reader.rdb.Del(ctx, reader.DataKey("dish", "1"))
+
+	var dish Dish
+	assert.Nil(t, reader.Get(ctx, "1", &dish))
+	assert.Nil(t, writer.refresh(ctx, "dish", "1", func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 1, Name: "renamed"}, 0, nil
+	}))
+	assert.Equal(t, 0, len(invalidated))
+
+	// the stale local copy is served while the worker applies the new version
+	assert.Nil(t, reader.Get(ctx, "1", &dish))
+	select {
+	case k := <-invalidated:
+		assert.Equal(t, jointKey("dish", "1"), k)
+	case <-time.After(time.Second):
+		t.Errorf("invalidation not reported")
+		return
+	}
+	assert.Nil(t, reader.Get(ctx, "1", &dish))
+	assert.Equal(t, "renamed", dish.Name)
+
+	removed, err := reader.DeleteByPattern(ctx, reader.DataKey("dish", "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, jointKey("dish", "1"), <-invalidated)
+}
+
+func TestLevelCache_OnLocalEviction(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		LocalExpiration: 50 * time.Millisecond,
+		CleanupInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	reasons := make(chan EvictReason, 10)
+	cache.OnLocalEviction(func(namespace, key string, reason EvictReason) {
+		if namespace == "dish" && key == "78" {
+			reasons <- reason
+		}
+	})
+
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 78, Name: "short"}))
+	select {
+	case reason := <-reasons:
+		assert.Equal(t, EvictExpired, reason)
+	case <-time.After(time.Second):
+		t.Errorf("expiry not reported")
+		return
+	}
+
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 78, Name: "deleted"}))
+	_, _, version, err := cache.Inspect(context.TODO(), "dish", "78")
+	assert.Nil(t, err)
+	deleted, err := cache.DeleteIfVersion(context.TODO(), "dish", "78", version)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	select {
+	case reason := <-reasons:
+		assert.Equal(t, EvictDeleted, reason)
+	case <-time.After(time.Second):
+		t.Errorf("delete not reported")
+	}
+}
@@ -0,0 +1,116 @@
+package levelcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// hashedKeyPrefix marks the keys and key parts shortened by hashedKey
+const hashedKeyPrefix = "sha256:"
+
+// minKeyLength is the length of a key hashed as a whole, the shortest MaxKeyLength
+const minKeyLength = len(hashedKeyPrefix) + 2*sha256.Size
+
+// maxKeyNames bounds the keys shortened by hashedKey which splitKey can restore
+const maxKeyNames = 4096
+
+func (p *CacheConfig) checkMaxKeyLength() error {
+	if p.MaxKeyLength < 0 || (p.MaxKeyLength > 0 && p.MaxKeyLength < minKeyLength) {
+		return fmt.Errorf("invalid max key length %d, hashed keys take %d bytes", p.MaxKeyLength, minKeyLength)
+	}
+	return nil
+}
+
+// hashedKey shortens k, built by the KeyEncoder from parts and longer than MaxKeyLength.
+// Every part but the last is kept readable, the last one is replaced by its sha256, so the key of a long value
+// is e.g. namespace#$#sha256:<hex> and its version version#$#namespace#$#sha256:<hex> with the same hash.
+// When the parts kept are too long themselves the whole key is the sha256 of that shortened key.
+// A last part already of the form sha256:<hex> is kept, so that the keys built again from split ones match.
+func (p *LevelCache) hashedKey(k string, parts []string) string {
+	last := parts[len(parts)-1]
+	if !isHashedPart(last) {
+		sum := sha256.Sum256([]byte(last))
+		hashed := hashedKeyPrefix + hex.EncodeToString(sum[:])
+		p.keyNames.record(hashed, last)
+		shortened := make([]string, len(parts))
+		copy(shortened, parts[:len(parts)-1])
+		shortened[len(parts)-1] = hashed
+		k = p.cfg.KeyEncoder.Encode(shortened...)
+	}
+	if len(k) <= p.cfg.MaxKeyLength {
+		return k
+	}
+	sum := sha256.Sum256([]byte(k))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// isHashedPart reports whether part has the form of the parts shortened by hashedKey
+func isHashedPart(part string) bool {
+	if len(part) != minKeyLength || !strings.HasPrefix(part, hashedKeyPrefix) {
+		return false
+	}
+	_, err := hex.DecodeString(part[len(hashedKeyPrefix):])
+	return err == nil
+}
+
+// keySplitter is implemented by the KeyEncoders whose keys can be split back into their parts
+type keySplitter interface {
+	split(k string) ([]string, bool)
+}
+
+// splitKey splits k, built by a KeyEncoder implementing keySplitter, back into its parts.
+// A last part shortened by hashedKey is restored when this instance shortened it recently,
+// otherwise it stays sha256:<hex>. Keys hashed as a whole cannot be split.
+func (p *LevelCache) splitKey(k string) ([]string, bool) {
+	splitter, ok := p.cfg.KeyEncoder.(keySplitter)
+	if !ok {
+		return nil, false
+	}
+	parts, ok := splitter.split(k)
+	if !ok {
+		return nil, false
+	}
+	if last := parts[len(parts)-1]; isHashedPart(last) {
+		if name, ok := p.keyNames.name(last); ok {
+			parts[len(parts)-1] = name
+		}
+	}
+	return parts, true
+}
+
+// keyNames remembers the last maxKeyNames key parts shortened by hashedKey, by hashed form
+type keyNames struct {
+	mu    sync.Mutex
+	names map[string]string
+	order []string
+	next  int
+}
+
+func (p *keyNames) record(hashed, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.names[hashed]; ok {
+		return
+	}
+	if p.names == nil {
+		p.names = make(map[string]string)
+	}
+	if len(p.order) < maxKeyNames {
+		p.order = append(p.order, hashed)
+	} else {
+		delete(p.names, p.order[p.next])
+		p.order[p.next] = hashed
+		p.next = (p.next + 1) % maxKeyNames
+	}
+	p.names[hashed] = name
+}
+
+func (p *keyNames) name(hashed string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name, ok := p.names[hashed]
+	return name, ok
+}
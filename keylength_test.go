@@ -0,0 +1,206 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_MaxKeyLength(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 90, Name: key}, nil
+	})
+	ctx := context.TODO()
+	long := strings.Repeat("long-composite-key/", 10)
+	k := cache.DataKey("dish", long)
+	cache.rdb.Del(ctx, k, cache.VersionKey("dish", long))
+
+	// short keys stay readable, long ones are hashed the same way every time
+	assert.Equal(t, "dish#$#90", cache.DataKey("dish", "90"))
+	assert.True(t, strings.HasPrefix(k, "dish#$#sha256:"))
+	assert.True(t, len(k) <= 100)
+	assert.Equal(t, k, cache.DataKey("dish", long))
+	assert.NotEqual(t, k, cache.DataKey("dish", long+"x"))
+	assert.True(t, len(cache.VersionKey("dish", long)) <= 100)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, long, &dish))
+	assert.Equal(t, long, dish.Name)
+	content, err := cache.rdb.Get(ctx, k).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, toJson(&dish), content)
+
+	// another instance reads it back from redis through the hashed key
+	other, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var read Dish
+	assert.Nil(t, other.Get(ctx, long, &read))
+	assert.Equal(t, dish, read)
+
+	assert.Nil(t, cache.refresh(ctx, "dish", long, func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 90, Name: "refreshed"}, 0, nil
+	}))
+	assert.Nil(t, other.Get(ctx, long, &read, SkipLocal()))
+	assert.Equal(t, "refreshed", read.Name)
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, cache.VersionKey("dish", long)).Val())
+}
+
+// longNamespaceDish lives in a namespace longer than MaxKeyLength allows to keep readable
+type longNamespaceDish struct {
+	Dish
+}
+
+func (p *longNamespaceDish) Namespace() string {
+	return strings.Repeat("long-namespace/", 5)
+}
+
+func TestLevelCache_MaxKeyLengthNamespace(t *testing.T) {
+	_, err := New(CacheConfig{RedisAddr: "localhost:6379", MaxKeyLength: minKeyLength - 1})
+	assert.NotNil(t, err)
+	_, err = NewLocalOnly(CacheConfig{MaxKeyLength: minKeyLength - 1})
+	assert.NotNil(t, err)
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  minKeyLength,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	namespace := (&longNamespaceDish{}).Namespace()
+	for _, key := range []string{cache.DataKey(namespace, "94"), cache.VersionKey(namespace, "94"), cache.lockKey(namespace, "94")} {
+		assert.True(t, len(key) <= minKeyLength)
+		assert.True(t, strings.HasPrefix(key, hashedKeyPrefix))
+	}
+	assert.NotEqual(t, cache.DataKey(namespace, "94"), cache.VersionKey(namespace, "94"))
+
+	assert.Nil(t, cache.Set(ctx, &longNamespaceDish{Dish{ID: 94, Name: "long"}}))
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, cache.DataKey(namespace, "94")).Val())
+	var dish longNamespaceDish
+	src, err := cache.GetWithSource(ctx, "94", &dish, SkipLocal())
+	assert.Nil(t, err)
+	assert.Equal(t, SourceRedis, src)
+	assert.Equal(t, "long", dish.Name)
+}
+
+func TestLevelCache_MaxKeyLengthDeleteByPattern(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 98, Name: key}, nil
+	})
+	var invalidated, evicted []string
+	cache.OnInvalidate(func(namespace, key string) {
+		invalidated = append(invalidated, namespace+"/"+key)
+	})
+	cache.OnLocalEviction(func(namespace, key string, reason EvictReason) {
+		evicted = append(evicted, namespace+"/"+key)
+	})
+	ctx := context.TODO()
+	long := strings.Repeat("pattern-composite-key/", 10)
+	k := cache.DataKey("dish", long)
+	assert.Nil(t, cache.refresh(ctx, "dish", long, func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 98, Name: long}, 0, nil
+	}))
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, long, &dish))
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, cache.VersionKey("dish", long)).Val())
+	invalidated, evicted = nil, nil
+
+	// the value, its version and the local entry go away and callbacks get the key, not its hash
+	removed, err := cache.DeleteByPattern(ctx, k)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k, cache.VersionKey("dish", long)).Val())
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"dish/" + long}, invalidated)
+	assert.Equal(t, []string{"dish/" + long}, evicted)
+
+	// an instance which never built the key still removes the version, reporting the hashed key
+	other, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var keys []string
+	other.OnInvalidate(func(namespace, key string) {
+		keys = append(keys, key)
+	})
+	assert.Nil(t, cache.refresh(ctx, "dish", long, func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 98, Name: long}, 0, nil
+	}))
+	_, err = other.DeleteByPattern(ctx, k)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k, cache.VersionKey("dish", long)).Val())
+	assert.Equal(t, []string{strings.TrimPrefix(k, "dish#$#")}, keys)
+}
+
+func TestLevelCache_MaxKeyLengthReloadNamespace(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxKeyLength:  100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 99, Name: "old"}, nil
+	})
+	var invalidated, evicted []string
+	cache.OnInvalidate(func(namespace, key string) {
+		invalidated = append(invalidated, namespace+"/"+key)
+	})
+	cache.OnLocalEviction(func(namespace, key string, reason EvictReason) {
+		evicted = append(evicted, namespace+"/"+key)
+	})
+	ctx := context.TODO()
+	long := strings.Repeat("reload-composite-key/", 10)
+	k := cache.DataKey("dish", long)
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, long, &dish))
+	assert.Equal(t, "old", dish.Name)
+	invalidated, evicted = nil, nil
+
+	assert.Nil(t, cache.ReloadNamespace(ctx, "dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 99, Name: "new"}, nil
+	}))
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k).Val())
+	assert.Contains(t, invalidated, "dish/"+long)
+	assert.Contains(t, evicted, "dish/"+long)
+	assert.Nil(t, cache.Get(ctx, long, &dish))
+	assert.Equal(t, "new", dish.Name)
+}
@@ -0,0 +1,57 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// ListDataLoader loads the collection stored under key, such as the dishes of a category
+type ListDataLoader func(ctx context.Context, key string) ([]Cacheable, error)
+
+// listValue carries a collection through the single value read path, items is what gets serialized:
+// the loaded slice when writing and the slice pointer of GetList when reading
+type listValue struct {
+	namespace string
+	key       string
+	items     interface{}
+}
+
+func (p *listValue) Namespace() string {
+	return p.namespace
+}
+
+func (p *listValue) Key() string {
+	return p.key
+}
+
+// serialized returns what is serialized for obj, the items of a collection and obj itself otherwise
+func serialized(obj interface{}) interface{} {
+	if l, ok := obj.(*listValue); ok {
+		return l.items
+	}
+	return obj
+}
+
+// RegisterListLoader registers a loader of collections for namespace, read with GetList.
+// A collection is stored as a single array value and versioned like any other value.
+func (p *LevelCache) RegisterListLoader(namespace string, loader ListDataLoader) error {
+	return p.RegisterLoader(namespace, func(ctx context.Context, key string) (Cacheable, error) {
+		items, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return &listValue{namespace: namespace, key: key, items: items}, nil
+	})
+}
+
+// GetList fills out, a pointer to a slice, with the collection stored under key in namespace
+// and loads it with the ListDataLoader of the namespace on a miss.
+func (p *LevelCache) GetList(ctx context.Context, namespace, key string, out interface{}) error {
+	if v := reflect.ValueOf(out); v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: %T is not a pointer to a slice", ErrNilObject, out)
+	}
+	p.checkCacheUpdate(ctx, namespace, key)
+	_, err := p.get(ctx, key, &listValue{namespace: namespace, key: key, items: out}, getOptions{})
+	return err
+}
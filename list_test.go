@@ -0,0 +1,50 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_GetList(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterListLoader("dishesByCategory", func(ctx context.Context, key string) ([]Cacheable, error) {
+		loads++
+		return []Cacheable{
+			&Dish{ID: 1, Name: "MaPoDouFu"},
+			&Dish{ID: 2, Name: "GongBaoJiDing"},
+		}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.DataKey("dishesByCategory", "sichuan"))
+
+	var dishes []Dish
+	assert.Nil(t, cache.GetList(context.TODO(), "dishesByCategory", "sichuan", &dishes))
+	assert.Equal(t, []Dish{{ID: 1, Name: "MaPoDouFu"}, {ID: 2, Name: "GongBaoJiDing"}}, dishes)
+	assert.Equal(t, 1, loads)
+
+	var cached []*Dish
+	assert.Nil(t, cache.GetList(context.TODO(), "dishesByCategory", "sichuan", &cached))
+	assert.Len(t, cached, 2)
+	assert.Equal(t, "GongBaoJiDing", cached[1].Name)
+	assert.Equal(t, 1, loads)
+
+	// redis holds a plain JSON array
+	cache.c.Delete(cache.DataKey("dishesByCategory", "sichuan"))
+	dishes = nil
+	assert.Nil(t, cache.GetList(context.TODO(), "dishesByCategory", "sichuan", &dishes))
+	assert.Len(t, dishes, 2)
+	assert.Equal(t, 1, loads)
+	content, _ := cache.rdb.Get(context.TODO(), cache.DataKey("dishesByCategory", "sichuan")).Result()
+	assert.Equal(t, toJson([]Dish{{ID: 1, Name: "MaPoDouFu"}, {ID: 2, Name: "GongBaoJiDing"}}), content)
+
+	assert.True(t, errors.Is(cache.GetList(context.TODO(), "dishesByCategory", "sichuan", dishes), ErrNilObject))
+}
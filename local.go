@@ -0,0 +1,135 @@
+package levelcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// EvictReason tells why a local entry went away
+type EvictReason int
+
+const (
+	// EvictExpired is an entry purged once its expiration passed
+	EvictExpired EvictReason = iota
+	// EvictDeleted is an entry removed before expiring, because its value was deleted or went stale
+	EvictDeleted
+)
+
+func (r EvictReason) String() string {
+	if r == EvictDeleted {
+		return "deleted"
+	}
+	return "expired"
+}
+
+// localCache is the local level, striped over shards each guarded by its own lock
+// so that reads and writes of different keys rarely contend.
+type localCache struct {
+	shards []*cache.Cache
+	// deleting counts the running Deletes per key, telling them from expirations when an entry is evicted
+	deleting map[string]int
+	dmu      sync.Mutex
+}
+
+func newLocalCache(shards int, expiration time.Duration) *localCache {
+	if shards < 1 {
+		shards = 1
+	}
+	p := &localCache{shards: make([]*cache.Cache, shards), deleting: make(map[string]int)}
+	for i := range p.shards {
+		// expired entries are purged by LevelCache.cleanup
+		p.shards[i] = cache.New(expiration, 0)
+	}
+	return p
+}
+
+func (p *localCache) shard(k string) *cache.Cache {
+	if len(p.shards) == 1 {
+		return p.shards[0]
+	}
+	// inlined FNV-1a, hash/fnv would allocate on every call
+	h := uint32(2166136261)
+	for i := 0; i < len(k); i++ {
+		h ^= uint32(k[i])
+		h *= 16777619
+	}
+	return p.shards[h%uint32(len(p.shards))]
+}
+
+func (p *localCache) Get(k string) (interface{}, bool) {
+	return p.shard(k).Get(k)
+}
+
+func (p *localCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	return p.shard(k).GetWithExpiration(k)
+}
+
+func (p *localCache) Set(k string, x interface{}, d time.Duration) {
+	p.shard(k).Set(k, x, d)
+}
+
+func (p *localCache) SetDefault(k string, x interface{}) {
+	p.shard(k).SetDefault(k, x)
+}
+
+func (p *localCache) Delete(k string) {
+	p.dmu.Lock()
+	p.deleting[k]++
+	p.dmu.Unlock()
+	p.shard(k).Delete(k)
+	p.dmu.Lock()
+	if p.deleting[k]--; p.deleting[k] == 0 {
+		delete(p.deleting, k)
+	}
+	p.dmu.Unlock()
+}
+
+// DeleteIf removes the entries whose key matches
+func (p *localCache) DeleteIf(match func(k string) bool) {
+	for _, shard := range p.shards {
+		for k := range shard.Items() {
+			if match(k) {
+				p.Delete(k)
+			}
+		}
+	}
+}
+
+func (p *localCache) DeleteExpired() {
+	for _, shard := range p.shards {
+		shard.DeleteExpired()
+	}
+}
+
+func (p *localCache) ItemCount() int {
+	n := 0
+	for _, shard := range p.shards {
+		n += shard.ItemCount()
+	}
+	return n
+}
+
+// OnEvicted registers f to be called with the entries deleted or purged once expired, outside of the shard locks.
+// Entries replaced by a Set or dropped by Flush are not reported.
+func (p *localCache) OnEvicted(f func(k string, v interface{}, reason EvictReason)) {
+	for _, shard := range p.shards {
+		shard.OnEvicted(func(k string, v interface{}) {
+			// go-cache calls back on the goroutine evicting, within Delete for the deleted entries
+			p.dmu.Lock()
+			reason := EvictExpired
+			if p.deleting[k] > 0 {
+				reason = EvictDeleted
+			}
+			p.dmu.Unlock()
+			f(k, v, reason)
+		})
+	}
+}
+
+func (p *localCache) Flush() {
+	for _, shard := range p.shards {
+		shard.Flush()
+	}
+}
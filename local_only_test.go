@@ -0,0 +1,44 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewLocalOnly(t *testing.T) {
+	cache, err := NewLocalOnly(CacheConfig{})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	cache.Start(context.Background())
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, Stats{LocalHits: 1, Loads: 1}, cache.Stats())
+
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 1, Name: "set"}))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, "set", dish.Name)
+
+	cache.SetAsync(context.TODO(), &Dish{ID: 2, Name: "async"})
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Equal(t, "async", dish.Name)
+	assert.Equal(t, 1, loads)
+
+	_, err = cache.SetIfVersion(context.TODO(), &Dish{ID: 1}, 0)
+	assert.True(t, errors.Is(err, ErrRedisDisabled))
+	assert.True(t, errors.Is(cache.Ping(context.TODO()), ErrRedisDisabled))
+	_, err = cache.DeleteByPattern(context.TODO(), "*")
+	assert.True(t, errors.Is(err, ErrRedisDisabled))
+}
@@ -0,0 +1,60 @@
+package levelcache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLocalCache_Shards(t *testing.T) {
+	local := newLocalCache(8, time.Minute)
+	for i := 0; i < 100; i++ {
+		local.SetDefault(strconv.Itoa(i), i)
+	}
+	assert.Equal(t, 100, local.ItemCount())
+	for _, shard := range local.shards {
+		assert.True(t, shard.ItemCount() > 0)
+	}
+	for i := 0; i < 100; i++ {
+		v, ok := local.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, i, v)
+	}
+
+	evicted := 0
+	local.OnEvicted(func(_ string, _ interface{}, reason EvictReason) {
+		evicted++
+		assert.Equal(t, EvictDeleted, reason)
+	})
+	local.Delete("1")
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, 99, local.ItemCount())
+}
+
+func BenchmarkLocalCache(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = jointKey("dish", strconv.Itoa(i))
+	}
+	for _, shards := range []int{1, 16} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			local := newLocalCache(shards, time.Minute)
+			for _, k := range keys {
+				local.SetDefault(k, k)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					k := keys[i%len(keys)]
+					if i%10 == 0 {
+						local.SetDefault(k, k)
+					} else {
+						local.Get(k)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
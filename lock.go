@@ -0,0 +1,88 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bsm/redislock"
+)
+
+const (
+	defaultLockWarnFailures = 1000
+	defaultLockWarnWindow   = time.Minute
+	defaultLockMinBackoff   = 16 * time.Millisecond
+	defaultLockMaxBackoff   = 128 * time.Millisecond
+)
+
+// defaultLockRetryStrategy backs off exponentially between the attempts at a held reload lock
+func defaultLockRetryStrategy() redislock.RetryStrategy {
+	return redislock.ExponentialBackoff(defaultLockMinBackoff, defaultLockMaxBackoff)
+}
+
+// countedRetry calls failed on every attempt the wrapped strategy is asked to back off from
+type countedRetry struct {
+	redislock.RetryStrategy
+	failed func()
+}
+
+func (r countedRetry) NextBackoff() time.Duration {
+	r.failed()
+	return r.RetryStrategy.NextBackoff()
+}
+
+// lockWindow counts the failed lock attempts since start to spot contended locks
+type lockWindow struct {
+	mu       sync.Mutex
+	start    time.Time
+	failures int
+}
+
+// fail counts a failed attempt at now and reports whether it reached limit within window,
+// which happens at most once per window
+func (p *lockWindow) fail(now time.Time, window time.Duration, limit int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.start) > window {
+		p.start, p.failures = now, 0
+	}
+	p.failures++
+	return p.failures == limit
+}
+
+// obtainLock takes the reload lock of key, retrying with the LockRetryStrategy until it gives up,
+// the lock interval passes or ctx is done. The wait and the failed attempts are counted in Stats
+// and reported to Hooks.OnLockWait, a warning is logged when LockWarnFailures attempts fail within LockWarnWindow.
+func (p *LevelCache) obtainLock(ctx context.Context, namespace, key string) (*redislock.Lock, error) {
+	lockKey := p.lockKey(namespace, key)
+	start := p.cfg.Clock.Now()
+	failures := 0
+	retry := countedRetry{RetryStrategy: p.cfg.LockRetryStrategy(), failed: func() {
+		failures++
+		p.stats.failLock()
+		if p.lockWindow.fail(p.cfg.Clock.Now(), p.cfg.LockWarnWindow, p.cfg.LockWarnFailures) {
+			p.cfg.Logger.Printf("%d reload lock attempts failed within %s, last on [%s]",
+				p.cfg.LockWarnFailures, p.cfg.LockWarnWindow, lockKey)
+		}
+	}}
+	lock, err := p.locker.Obtain(ctx, lockKey, p.lockInterval(namespace), &redislock.Options{
+		RetryStrategy: retry,
+		Metadata:      p.cfg.LockMetadata,
+	})
+	p.recordLockWait(namespace, key, p.cfg.Clock.Now().Sub(start), failures, err == nil)
+	if err == nil {
+		return lock, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("reload lock [%s] key [%s]: %w", namespace, key, err)
+}
+
+func (p *LevelCache) recordLockWait(namespace, key string, wait time.Duration, failures int, acquired bool) {
+	p.stats.recordLock(wait, acquired)
+	if p.cfg.Hooks.OnLockWait != nil {
+		p.cfg.Hooks.OnLockWait(namespace, key, wait, failures, acquired)
+	}
+}
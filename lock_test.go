@@ -0,0 +1,111 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/bsm/redislock"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_LockInstrumentation(t *testing.T) {
+	var (
+		logger   recordLogger
+		waits    []time.Duration
+		acquired []bool
+	)
+	cache, err := New(CacheConfig{
+		RedisAddr:        "localhost:6379",
+		RedisPoolSize:    10,
+		LockWarnFailures: 5,
+		LockRetryStrategy: func() redislock.RetryStrategy {
+			return redislock.LinearBackoff(time.Millisecond)
+		},
+		Logger: &logger,
+		Hooks: Hooks{
+			OnLockWait: func(namespace, key string, wait time.Duration, failures int, ok bool) {
+				waits = append(waits, wait)
+				acquired = append(acquired, ok)
+			},
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	load := func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 37, Name: "locked"}, 0, nil
+	}
+	cache.rdb.Del(context.TODO(), cache.lockKey("dish", "37"))
+	held, err := cache.locker.Obtain(context.TODO(), cache.lockKey("dish", "37"), time.Minute, nil)
+	if err != nil {
+		t.Errorf("obtain lock fail:%+v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, cache.refresh(ctx, "dish", "37", load))
+	stats := cache.Stats()
+	assert.True(t, stats.LockFailures >= 5)
+	assert.Equal(t, uint64(0), stats.LocksAcquired)
+	assert.True(t, stats.LockWait >= 50*time.Millisecond)
+	assert.Equal(t, []bool{false}, acquired)
+	assert.True(t, waits[0] >= 50*time.Millisecond)
+	assert.Len(t, logger, 1)
+	assert.Contains(t, logger[0], "5 reload lock attempts failed")
+
+	_ = held.Release(context.TODO())
+	assert.Nil(t, cache.refresh(context.TODO(), "dish", "37", load))
+	assert.Equal(t, uint64(1), cache.Stats().LocksAcquired)
+	assert.Equal(t, []bool{false, true}, acquired)
+}
+
+// recordedRetry retries every 5 milliseconds, counting the backoffs asked
+type recordedRetry struct {
+	backoffs *int32
+}
+
+func (r recordedRetry) NextBackoff() time.Duration {
+	atomic.AddInt32(r.backoffs, 1)
+	return 5 * time.Millisecond
+}
+
+func TestLevelCache_LockRetryStrategy(t *testing.T) {
+	var strategies, backoffs int32
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		LockRetryStrategy: func() redislock.RetryStrategy {
+			atomic.AddInt32(&strategies, 1)
+			return recordedRetry{backoffs: &backoffs}
+		},
+		LockMetadata: "instance-1",
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	load := func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 81, Name: "contended"}, 0, nil
+	}
+	lockKey := cache.lockKey("dish", "81")
+	cache.rdb.Del(context.TODO(), lockKey)
+	held, err := cache.locker.Obtain(context.TODO(), lockKey, time.Minute, nil)
+	if err != nil {
+		t.Errorf("obtain lock fail:%+v", err)
+		return
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = held.Release(context.TODO())
+	}()
+
+	w, err := cache.reload(context.TODO(), "dish", "81", load)
+	assert.Nil(t, err)
+	defer w.release(context.TODO())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&strategies))
+	assert.True(t, atomic.LoadInt32(&backoffs) > 0)
+	assert.Equal(t, "instance-1", w.lock.Metadata())
+}
@@ -0,0 +1,140 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMemorySampleInterval = time.Minute
+	// memorySampleKeys is how many keys of a namespace the default MemorySampler measures with MEMORY USAGE
+	memorySampleKeys = 20
+	// memorySampleDraws is how many RANDOMKEY the default MemorySampler draws to find keys of a namespace
+	memorySampleDraws = 100
+)
+
+// SetRedisMemoryLimit caps the bytes the namespace may hold in redis, as estimated by the MemorySampler
+// every MemorySampleInterval. Past the limit the values of the namespace stop being written to redis and are
+// only cached locally, values already in redis being left to expire, until a later sample falls back under it.
+// Both decisions are logged. A limit below one removes the limit and resumes the writes.
+// Nothing is sampled until a first limit is set, nor by a cache created by NewLocalOnly.
+func (p *LevelCache) SetRedisMemoryLimit(namespace string, limit int64) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.memoryLimit = limit
+		if limit < 1 {
+			cfg.memoryLimit = 0
+			cfg.oversized = false
+		}
+	})
+	if limit > 0 && !p.localOnly() {
+		p.sampling.Do(func() {
+			go p.sampleMemory()
+		})
+	}
+}
+
+// oversized tells a namespace whose redis writes are suspended by SetRedisMemoryLimit
+func (p *LevelCache) oversized(namespace string) bool {
+	return p.namespaceConfig(namespace).oversized
+}
+
+// sampleMemory samples the namespaces given a memory limit until the cache is closed
+func (p *LevelCache) sampleMemory() {
+	for {
+		select {
+		case <-p.cfg.Clock.After(p.cfg.MemorySampleInterval):
+			p.checkMemory(context.Background())
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// checkMemory samples the namespaces given a memory limit and suspends or resumes their redis writes
+func (p *LevelCache) checkMemory(ctx context.Context) {
+	limits := make(map[string]int64)
+	p.nsmu.RLock()
+	for namespace, cfg := range p.namespaces {
+		if cfg.memoryLimit > 0 {
+			limits[namespace] = cfg.memoryLimit
+		}
+	}
+	p.nsmu.RUnlock()
+	for namespace, limit := range limits {
+		ctx, cancel := p.backgroundContext(ctx)
+		used, err := p.cfg.MemorySampler(ctx, namespace)
+		cancel()
+		if err != nil {
+			p.cfg.Logger.Printf("sample redis memory of [%s] fail: %v", namespace, err)
+			continue
+		}
+		over := used > limit
+		changed := false
+		p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+			// the limit may have been removed while sampling
+			if cfg.memoryLimit > 0 && cfg.oversized != over {
+				cfg.oversized = over
+				changed = true
+			}
+		})
+		switch {
+		case changed && over:
+			p.cfg.Logger.Printf("namespace [%s] holds about %d bytes in redis, over %d, redis writes suspended", namespace, used, limit)
+		case changed:
+			p.cfg.Logger.Printf("namespace [%s] holds about %d bytes in redis, under %d, redis writes resumed", namespace, used, limit)
+		}
+	}
+}
+
+// redisMemoryUsage is the default MemorySampler, it measures the hash of a namespace with HashStorage.
+// Otherwise memorySampleDraws random keys are drawn, the share of them in the namespace estimating how many
+// of the DBSIZE keys it has and the MEMORY USAGE of up to memorySampleKeys of them the size of each,
+// so that a sample costs the same whatever the size of redis. Namespaces holding few keys may be missed.
+func (p *LevelCache) redisMemoryUsage(ctx context.Context, namespace string) (int64, error) {
+	if p.hashStorage(namespace) {
+		used, err := p.rdb.MemoryUsage(ctx, p.hashKey(namespace), memorySampleKeys).Result()
+		if err != nil {
+			return 0, fmt.Errorf("memory usage of [%s]: %w", namespace, err)
+		}
+		return used, nil
+	}
+	pipe := p.rdb.Pipeline()
+	size := pipe.DBSize(ctx)
+	draws := make([]*redis.StringCmd, memorySampleDraws)
+	for i := range draws {
+		draws[i] = pipe.RandomKey(ctx)
+	}
+	// RANDOMKEY replies nil to an empty database
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("sample keys of [%s]: %w", namespace, err)
+	}
+	prefix := p.cfg.KeyEncoder.Encode(namespace, "")
+	var matched, sampled, used int64
+	for _, draw := range draws {
+		k, err := draw.Result()
+		if err != nil || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		matched++
+		if sampled == memorySampleKeys {
+			continue
+		}
+		n, err := p.rdb.MemoryUsage(ctx, k).Result()
+		if err == redis.Nil {
+			// expired since drawn
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("memory usage of [%s]: %w", namespace, err)
+		}
+		used += n
+		sampled++
+	}
+	if sampled == 0 {
+		return 0, nil
+	}
+	return used / sampled * size.Val() * matched / memorySampleDraws, nil
+}
@@ -0,0 +1,108 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_SetRedisMemoryLimit(t *testing.T) {
+	var used int64
+	cache, err := New(CacheConfig{
+		RedisAddr:            "localhost:6379",
+		RedisPoolSize:        10,
+		MemorySampleInterval: 10 * time.Millisecond,
+		MemorySampler: func(ctx context.Context, namespace string) (int64, error) {
+			return atomic.LoadInt64(&used), nil
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	ctx := context.TODO()
+	k79, k80 := cache.cacheKey("dish", "79"), cache.cacheKey("dish", "80")
+	cache.rdb.Del(ctx, k79, k80)
+	cache.SetRedisMemoryLimit("dish", 1000)
+
+	atomic.StoreInt64(&used, 500)
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 79}))
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, k79).Val())
+
+	// crossing the limit stops the redis writes, the local cache still takes them
+	atomic.StoreInt64(&used, 2000)
+	assert.Eventually(t, func() bool { return cache.oversized("dish") }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 80}))
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k80).Val())
+	var dish Dish
+	found, err := cache.GetLocal("80", &dish)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	_, err = cache.SetIfVersion(ctx, &Dish{ID: 80}, 0)
+	assert.True(t, errors.Is(err, ErrRedisWritesSuspended))
+	assert.False(t, cache.oversized("bulkDish"))
+
+	// falling back under it resumes them
+	atomic.StoreInt64(&used, 100)
+	assert.Eventually(t, func() bool { return !cache.oversized("dish") }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 80}))
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, k80).Val())
+
+	atomic.StoreInt64(&used, 2000)
+	assert.Eventually(t, func() bool { return cache.oversized("dish") }, time.Second, 10*time.Millisecond)
+	cache.SetRedisMemoryLimit("dish", 0)
+	assert.False(t, cache.oversized("dish"))
+}
+
+func TestLevelCache_SampleMemoryLazily(t *testing.T) {
+	var samples int64
+	cache, err := New(CacheConfig{
+		RedisAddr:            "localhost:6379",
+		RedisPoolSize:        10,
+		MemorySampleInterval: time.Millisecond,
+		MemorySampler: func(ctx context.Context, namespace string) (int64, error) {
+			atomic.AddInt64(&samples, 1)
+			return 0, nil
+		},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	// no limit, nothing to sample
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&samples))
+	cache.SetRedisMemoryLimit("dish", 1000)
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&samples) > 0 }, time.Second, time.Millisecond)
+}
+
+func TestLevelCache_RedisMemoryUsage(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisDb:       5,
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	cache.rdb.FlushDB(ctx)
+	defer cache.rdb.FlushDB(ctx)
+	used, err := cache.redisMemoryUsage(ctx, "dish")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), used)
+
+	// the draws only measure keys of the namespace
+	for id := 0; id < 10; id++ {
+		assert.Nil(t, cache.Set(ctx, &Dish{ID: id, Name: "sampled"}))
+	}
+	used, err = cache.redisMemoryUsage(ctx, "drink")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), used)
+}
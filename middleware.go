@@ -0,0 +1,37 @@
+package levelcache
+
+import (
+	"context"
+	"time"
+)
+
+// UseLoaderMiddleware wraps every DataLoader call with mw, for the concerns shared by all loaders such as
+// retries, timeouts or circuit breaking. It applies to the loaders already registered as well as to the later ones.
+// Middlewares compose in order, the first one used being the outermost. BatchDataLoaders are not wrapped.
+func (p *LevelCache) UseLoaderMiddleware(mw func(DataLoader) DataLoader) {
+	if mw == nil {
+		return
+	}
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	p.middlewares = append(p.middlewares, mw)
+}
+
+func (p *LevelCache) loaderMiddlewares() []func(DataLoader) DataLoader {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	return p.middlewares
+}
+
+// wrapLoader wraps loader in middlewares, storing in ttl the lifetime returned by the last call of loader
+func wrapLoader(loader DataLoaderWithTTL, ttl *time.Duration, middlewares []func(DataLoader) DataLoader) DataLoader {
+	wrapped := DataLoader(func(ctx context.Context, key string) (Cacheable, error) {
+		data, d, err := loader(ctx, key)
+		*ttl = d
+		return data, err
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		wrapped = middlewares[i](wrapped)
+	}
+	return wrapped
+}
@@ -0,0 +1,49 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_UseLoaderMiddleware(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	attempts := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection reset")
+		}
+		return &Dish{ID: 87, Name: "retried"}, nil
+	})
+	var calls []string
+	cache.UseLoaderMiddleware(func(next DataLoader) DataLoader {
+		return func(ctx context.Context, key string) (Cacheable, error) {
+			calls = append(calls, "log")
+			return next(ctx, key)
+		}
+	})
+	cache.UseLoaderMiddleware(func(next DataLoader) DataLoader {
+		return func(ctx context.Context, key string) (Cacheable, error) {
+			calls = append(calls, "retry")
+			data, err := next(ctx, key)
+			if err != nil {
+				data, err = next(ctx, key)
+			}
+			return data, err
+		}
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "87"))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "87", &dish))
+	assert.Equal(t, "retried", dish.Name)
+	assert.Equal(t, 2, attempts)
+	// the first middleware used wraps the others
+	assert.Equal(t, []string{"log", "retry"}, calls)
+}
@@ -1,10 +1,133 @@
 package levelcache
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Cacheable interface {
 	Namespace() string
 	Key() string
 }
 
+// KeyParter is implemented by the Cacheable objects keyed by several fields, such as a tenant and an id.
+// The cache stores them under JoinKey of their parts instead of Key, so that no combination of parts
+// collides with another the way concatenated fields could.
+type KeyParter interface {
+	KeyParts() []string
+}
+
+// JoinKey joins the fields of a composite key, escaping them so that different fields never give the same key.
+// It is the key to Get the objects implementing KeyParter with.
+func JoinKey(parts ...string) string {
+	return jointKey(parts...)
+}
+
+// ObjectKey returns the key obj is stored under, JoinKey of its parts for a KeyParter and Key otherwise.
+func ObjectKey(obj Cacheable) string {
+	if kp, ok := obj.(KeyParter); ok {
+		return JoinKey(kp.KeyParts()...)
+	}
+	return obj.Key()
+}
+
+// DataLoader loads the value of key from the source of truth.
+// The returned object is serialized right away and never retained by the cache,
+// so loaders may reuse or pool it.
 type DataLoader func(ctx context.Context, key string) (Cacheable, error)
+
+// DataLoaderWithTTL is a DataLoader also returning how long the value stays valid,
+// a zero duration falls back to the LocalExpiration and RedisExpiration of each level.
+type DataLoaderWithTTL func(ctx context.Context, key string) (Cacheable, time.Duration, error)
+
+func withDefaultTTL(loader DataLoader) DataLoaderWithTTL {
+	return func(ctx context.Context, key string) (Cacheable, time.Duration, error) {
+		data, err := loader(ctx, key)
+		return data, 0, err
+	}
+}
+
+// BatchDataLoader loads many keys of a namespace at once, keys absent from the result are treated as not found.
+type BatchDataLoader func(ctx context.Context, keys []string) (map[string]Cacheable, error)
+
+// KeyEncoder builds the composite key stored in redis and the local cache from its parts.
+// Encode must be deterministic and should never map different parts to the same key.
+type KeyEncoder interface {
+	Encode(parts ...string) string
+}
+
+type KeyEncoderFunc func(parts ...string) string
+
+func (f KeyEncoderFunc) Encode(parts ...string) string {
+	return f(parts...)
+}
+
+// Cache is the public behaviour of the cache returned by New and NewLocalOnly,
+// depend on it to replace the cache by the fakes of the cachetest package in tests.
+// It leaves out WithBatch, whose Batch is bound to a LevelCache, and Collector, built with the prometheus tag.
+type Cache interface {
+	Get(ctx context.Context, key string, obj Cacheable, opts ...GetOption) error
+	GetWithSource(ctx context.Context, key string, obj Cacheable, opts ...GetOption) (Source, error)
+	GetWithStale(ctx context.Context, key string, obj Cacheable) (bool, error)
+	GetOrSeed(ctx context.Context, key string, obj Cacheable, seed Seed) error
+	GetLocal(key string, obj Cacheable) (bool, error)
+	GetWithTTL(ctx context.Context, key string, obj Cacheable) (time.Duration, error)
+	GetIfChanged(ctx context.Context, namespace, key string, sinceVersion int64, obj Cacheable) (bool, error)
+	GetVersioned(ctx context.Context, key string, obj Cacheable) (int64, error)
+	GetMany(ctx context.Context, namespace string, keys []string, newObj func() Cacheable) (map[string]Cacheable, error)
+	GetList(ctx context.Context, namespace, key string, out interface{}) error
+	Set(ctx context.Context, obj Cacheable) error
+	SetIfVersion(ctx context.Context, obj Cacheable, expectedVersion int64) (bool, error)
+	SetAsync(ctx context.Context, obj Cacheable)
+	MSet(ctx context.Context, objs []Cacheable) error
+	Touch(ctx context.Context, namespace, key string, ttl time.Duration) error
+	Refresh(ctx context.Context, namespace, key string) *RefreshHandle
+	RefreshMany(ctx context.Context, namespace string, keys []string) error
+	AutoRefresh(namespace string, keys []string, interval time.Duration)
+	StopAutoRefresh(namespace string, keys ...string)
+	PrewarmLocal(ctx context.Context, namespace string, keys []string) error
+	Delete(ctx context.Context, namespace, key string) error
+	DeleteIfVersion(ctx context.Context, namespace, key string, expectedVersion int64) (bool, error)
+	DeleteByPattern(ctx context.Context, pattern string) (int, error)
+	ClearNamespace(ctx context.Context, namespace string) error
+	ReloadNamespace(ctx context.Context, namespace string, loader DataLoader) error
+	FlushLocal()
+
+	RegisterLoader(namespace string, loader DataLoader) error
+	RegisterLoaderWithTTL(namespace string, loader DataLoaderWithTTL) error
+	RegisterTypedLoader(sample Cacheable, loader DataLoader) error
+	RegisterBatchLoader(namespace string, loader BatchDataLoader) error
+	RegisterListLoader(namespace string, loader ListDataLoader) error
+	RegisterLoaderChain(namespace string, loaders ...DataLoader) error
+	RegisterLoaders(loaders map[string]DataLoader)
+	UseLoaderMiddleware(mw func(DataLoader) DataLoader)
+	Namespaces() []string
+
+	SetLocalCacheDisabled(namespace string, disabled bool)
+	SetAlwaysReadRedis(namespace string, enabled bool)
+	SetVersioningDisabled(namespace string, disabled bool)
+	SetHashStorage(namespace string, enabled bool)
+	SetLockInterval(namespace string, interval time.Duration)
+	SetValidator(namespace string, validate func(obj Cacheable) error)
+	SetMaxConcurrentLoads(namespace string, limit int)
+	SetNamespaceSerializer(namespace string, s Serializer)
+	SetNamespaceSchema(namespace string, version int, migrate Migrate)
+	SetRedisMemoryLimit(namespace string, limit int64)
+	SetUpdateBuffer(n int)
+
+	OnInvalidate(fn func(namespace, key string))
+	OnLocalEviction(fn func(namespace, key string, reason EvictReason))
+	Events() <-chan CacheEvent
+
+	DataKey(namespace, key string) string
+	VersionKey(namespace, key string) string
+	Inspect(ctx context.Context, namespace, key string) (local string, remote string, version int64, err error)
+	History(ctx context.Context, namespace, key string, limit int) ([]string, error)
+
+	Start(ctx context.Context) error
+	Stop()
+	Close() error
+	Stats() Stats
+	Ping(ctx context.Context) error
+	Health(ctx context.Context) HealthStatus
+}
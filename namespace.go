@@ -0,0 +1,114 @@
+package levelcache
+
+import (
+	"fmt"
+	"time"
+)
+
+// namespaceConfig holds the settings tuned per namespace at runtime
+type namespaceConfig struct {
+	localDisabled      bool
+	versioningDisabled bool
+	hashStorage        bool
+	alwaysReadRedis    bool
+	lockInterval       time.Duration
+	serializer         Serializer
+	validator          func(obj Cacheable) error
+	schema             int
+	migrate            Migrate
+	// memoryLimit is set by SetRedisMemoryLimit, oversized while the sampled memory exceeds it
+	memoryLimit int64
+	oversized   bool
+	// loadSlots holds a token per running loader when concurrent loads are limited
+	loadSlots chan struct{}
+}
+
+func (p *LevelCache) namespaceConfig(namespace string) namespaceConfig {
+	p.nsmu.RLock()
+	defer p.nsmu.RUnlock()
+	return p.namespaces[namespace]
+}
+
+func (p *LevelCache) updateNamespaceConfig(namespace string, update func(cfg *namespaceConfig)) {
+	p.nsmu.Lock()
+	defer p.nsmu.Unlock()
+	cfg := p.namespaces[namespace]
+	update(&cfg)
+	p.namespaces[namespace] = cfg
+}
+
+// SetLocalCacheDisabled makes the namespace skip the local cache and version polling,
+// always reading redis, which saves memory for large and rarely accessed objects.
+// Entries cached locally before disabling are left to expire.
+func (p *LevelCache) SetLocalCacheDisabled(namespace string, disabled bool) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.localDisabled = disabled
+	})
+}
+
+// SetAlwaysReadRedis makes the reads of the namespace always fetch the value from redis, even on a local hit,
+// for values which must never be served stale such as balances. The local cache is still written so that
+// GetLocal and the other local readers see the latest value read, and no version is polled.
+func (p *LevelCache) SetAlwaysReadRedis(namespace string, enabled bool) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.alwaysReadRedis = enabled
+	})
+}
+
+// SetVersioningDisabled makes the namespace skip version polling and version writes like DisableVersioning.
+func (p *LevelCache) SetVersioningDisabled(namespace string, disabled bool) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.versioningDisabled = disabled
+	})
+}
+
+func (p *LevelCache) versioningDisabled(namespace string) bool {
+	return p.cfg.DisableVersioning || p.cfg.SingleInstance || p.namespaceConfig(namespace).versioningDisabled
+}
+
+// SetLockInterval overrides LockInterval for the reload locks of the namespace, zero restores the default.
+func (p *LevelCache) SetLockInterval(namespace string, interval time.Duration) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.lockInterval = interval
+	})
+}
+
+func (p *LevelCache) lockInterval(namespace string) time.Duration {
+	if interval := p.namespaceConfig(namespace).lockInterval; interval > 0 {
+		return interval
+	}
+	return p.cfg.LockInterval
+}
+
+// SetValidator makes the loaded values of the namespace pass validate before being cached,
+// a value it rejects is written to neither level and its error is returned by the Get or Refresh.
+// Return an error wrapping ErrNotFound to treat the value as missing, e.g. to serve the WithDefault object.
+// A nil validate removes the validator.
+func (p *LevelCache) SetValidator(namespace string, validate func(obj Cacheable) error) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.validator = validate
+	})
+}
+
+func (p *LevelCache) validate(namespace, key string, obj Cacheable) error {
+	validate := p.namespaceConfig(namespace).validator
+	if validate == nil {
+		return nil
+	}
+	if err := validate(obj); err != nil {
+		return fmt.Errorf("invalid value [%s] key [%s]: %w", namespace, key, err)
+	}
+	return nil
+}
+
+// SetMaxConcurrentLoads limits how many loaders of the namespace may run at once, excess loads wait for a slot.
+// A limit below one removes the limit.
+func (p *LevelCache) SetMaxConcurrentLoads(namespace string, limit int) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		if limit < 1 {
+			cfg.loadSlots = nil
+			return
+		}
+		cfg.loadSlots = make(chan struct{}, limit)
+	})
+}
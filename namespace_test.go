@@ -0,0 +1,401 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_SetLocalCacheDisabled(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.SetLocalCacheDisabled("dish", true)
+
+	for i := 0; i < 2; i++ {
+		var dish Dish
+		if err := cache.Get(context.TODO(), "2", &dish); err != nil {
+			t.Errorf("get cache fail:%+v", err)
+			return
+		}
+		assert.Equal(t, 2, dish.ID)
+	}
+	assert.Nil(t, cache.RefreshMany(context.TODO(), "dish", []string{"1", "2"}))
+	assert.Equal(t, 0, cache.c.ItemCount())
+	assert.Empty(t, cache.version)
+
+	cache.SetLocalCacheDisabled("dish", false)
+	var dish Dish
+	if err := cache.Get(context.TODO(), "2", &dish); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.Equal(t, 1, cache.c.ItemCount())
+}
+
+func TestLevelCache_LockKey(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("bulkDish", getBulkDish)
+	assert.NotEqual(t, cache.lockKey("dish", "1"), cache.lockKey("bulkDish", "1"))
+	assert.NotEqual(t, cache.lockKey("dish", "1#$#2"), cache.lockKey("dish#$#1", "2"))
+
+	cache.SetLockInterval("bulkDish", time.Second)
+	assert.Equal(t, time.Second, cache.lockInterval("bulkDish"))
+	assert.Equal(t, cache.cfg.LockInterval, cache.lockInterval("dish"))
+
+	// a held dish lock must not block refreshing the same key of another namespace
+	lock, err := cache.locker.Obtain(context.TODO(), cache.lockKey("dish", "1"), time.Minute, nil)
+	if err != nil {
+		t.Errorf("obtain lock fail:%+v", err)
+		return
+	}
+	defer func() {
+		_ = lock.Release(context.TODO())
+	}()
+	ctx, cancel := context.WithTimeout(context.TODO(), 500*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, cache.RefreshMany(ctx, "bulkDish", []string{"1"}))
+}
+
+func TestLevelCache_MaxConcurrentLoads(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:          "localhost:6379",
+		RedisPoolSize:      10,
+		MaxConcurrentLoads: map[string]int{"dish": 2},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	var running, peak int32
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return &Dish{Name: key}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		key := "concurrent" + strconv.Itoa(i)
+		cache.rdb.Del(context.TODO(), cache.cacheKey("dish", key))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dish Dish
+			assert.Nil(t, cache.Get(context.TODO(), key, &dish))
+			assert.Equal(t, key, dish.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak)
+
+	// waiting for a slot gives up with the context
+	cache.SetMaxConcurrentLoads("dish", 1)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "slot"), cache.cacheKey("dish", "waiting"))
+	go func() {
+		var dish Dish
+		_ = cache.Get(context.TODO(), "slot", &dish)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Millisecond)
+	defer cancel()
+	var dish Dish
+	assert.Equal(t, context.DeadlineExceeded, cache.Get(ctx, "waiting", &dish))
+}
+
+// dishView shares the dish namespace without being a Dish
+type dishView struct {
+	Dish
+}
+
+func TestLevelCache_RegisterTypedLoader(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.True(t, errors.Is(cache.RegisterTypedLoader(nil, GetDish), ErrNilObject))
+	assert.Nil(t, cache.RegisterTypedLoader(&Dish{}, GetDish))
+	assert.Equal(t, []string{"dish"}, cache.Namespaces())
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, 1, dish.ID)
+
+	var view dishView
+	err = cache.Get(context.TODO(), "1", &view)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Contains(t, err.Error(), "*levelcache.dishView")
+
+	// a typed loader producing another type than its sample
+	assert.Nil(t, cache.RegisterTypedLoader(&Drink{}, func(ctx context.Context, key string) (Cacheable, error) {
+		return &struct{ Drink }{}, nil
+	}))
+	cache.rdb.Del(context.TODO(), cache.cacheKey("drink", "1"))
+	var drink Drink
+	assert.True(t, errors.Is(cache.Get(context.TODO(), "1", &drink), ErrTypeMismatch))
+}
+
+// commandCounter counts the commands sent to redis by name
+type commandCounter struct {
+	mu       sync.Mutex
+	commands map[string][]string
+}
+
+func (p *commandCounter) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(cmd.Args()) > 1 {
+		p.commands[cmd.Name()] = append(p.commands[cmd.Name()], fmt.Sprint(cmd.Args()[1]))
+	}
+	return ctx, nil
+}
+
+func (p *commandCounter) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+// BeforeProcessPipeline records the size of every pipeline under "pipeline"
+func (p *commandCounter) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commands["pipeline"] = append(p.commands["pipeline"], fmt.Sprint(len(cmds)))
+	return ctx, nil
+}
+
+func (p *commandCounter) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_DisableVersioning(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:         "localhost:6379",
+		RedisPoolSize:     10,
+		DisableVersioning: true,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "2"), cache.versionKey("dish", "2"), cache.versionKey("dish", "6"))
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 6}))
+	assert.Nil(t, cache.refresh(context.TODO(), "dish", "2", func() (Cacheable, time.Duration, error) {
+		return cache.load(context.TODO(), "dish", "2", cache.loaders["dish"])
+	}))
+	_, err = cache.SetIfVersion(context.TODO(), &Dish{ID: 6}, 1)
+	assert.True(t, errors.Is(err, ErrVersioningDisabled))
+
+	assert.Nil(t, cache.rdb.Get(context.TODO(), cache.cacheKey("dish", "6")).Err())
+	for _, key := range []string{"2", "6"} {
+		n, err := cache.rdb.Exists(context.TODO(), cache.versionKey("dish", key)).Result()
+		assert.Nil(t, err)
+		assert.Zero(t, n)
+	}
+	for _, k := range counter.commands["get"] {
+		assert.False(t, strings.HasPrefix(k, cache.cacheKey("version", "")), "version read %s", k)
+	}
+	assert.NotContains(t, counter.commands["evalsha"], setScript.Hash())
+	assert.Empty(t, counter.commands["incr"])
+}
+
+func TestLevelCache_SingleInstance(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:      "localhost:6379",
+		RedisPoolSize:  10,
+		SingleInstance: true,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "2"), cache.versionKey("dish", "2"))
+	cache.Start(context.Background())
+	defer cache.Stop()
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Nil(t, cache.refresh(context.TODO(), "dish", "2", func() (Cacheable, time.Duration, error) {
+		return &Dish{ID: 2, Name: "refreshed"}, 0, nil
+	}))
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Equal(t, "refreshed", dish.Name)
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 2, Name: "set"}))
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish))
+	assert.Equal(t, "set", dish.Name)
+	assert.Equal(t, uint64(3), cache.Stats().LocalHits)
+
+	for name, args := range counter.commands {
+		for _, k := range args {
+			assert.False(t, strings.HasPrefix(k, cache.cacheKey("version", "")), "version %s %s", name, k)
+		}
+	}
+	assert.NotContains(t, counter.commands["evalsha"], setScript.Hash())
+	n, _ := cache.rdb.Exists(context.TODO(), cache.versionKey("dish", "2")).Result()
+	assert.Zero(t, n)
+}
+
+func TestLevelCache_SetValidator(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if key == "41" {
+			return &Dish{}, nil
+		}
+		return GetDish(ctx, key)
+	})
+	errEmpty := errors.New("empty dish")
+	cache.SetValidator("dish", func(obj Cacheable) error {
+		if obj.(*Dish).ID == 0 {
+			return errEmpty
+		}
+		return nil
+	})
+	k := cache.cacheKey("dish", "41")
+	cache.rdb.Del(ctx, k, cache.cacheKey("dish", "1"))
+
+	var dish Dish
+	assert.True(t, errors.Is(cache.Get(ctx, "41", &dish), errEmpty))
+	err = cache.refresh(ctx, "dish", "41", func() (Cacheable, time.Duration, error) {
+		return cache.load(ctx, "dish", "41", cache.loaders["dish"])
+	})
+	assert.True(t, errors.Is(err, errEmpty))
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+	assert.Equal(t, redis.Nil, cache.rdb.Get(ctx, k).Err())
+
+	// valid values are cached as usual
+	assert.Nil(t, cache.Get(ctx, "1", &dish))
+	_, ok = cache.c.Get(cache.cacheKey("dish", "1"))
+	assert.True(t, ok)
+
+	// rejected values wrapping ErrNotFound are treated as missing
+	cache.SetValidator("dish", func(obj Cacheable) error {
+		if obj.(*Dish).ID == 0 {
+			return fmt.Errorf("empty dish %w", ErrNotFound)
+		}
+		return nil
+	})
+	assert.Nil(t, cache.Get(ctx, "41", &dish, WithDefault(&Dish{Name: "unknown"}, 0)))
+	assert.Equal(t, "unknown", dish.Name)
+	_, ok = cache.c.Get(k)
+	assert.False(t, ok)
+}
+
+func TestLevelCache_RegisterLoadersConcurrently(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, cache.Start(context.Background()))
+	defer cache.Stop()
+	_ = cache.RegisterLoader("dish", GetDish)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				namespace := fmt.Sprintf("race_%d_%d", i, j)
+				if j%2 == 0 {
+					assert.Nil(t, cache.RegisterLoader(namespace, GetDish))
+				} else {
+					cache.RegisterLoaders(map[string]DataLoader{namespace: GetDish})
+				}
+				cache.Namespaces()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				var dish Dish
+				assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, cache.Namespaces(), 81)
+}
+
+func TestLevelCache_AlwaysReadRedis(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache.SetAlwaysReadRedis("dish", true)
+	k := cache.cacheKey("dish", "75")
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 75, Name: "v1"}))
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	// redis moves on without a version bump, the local copy would never be told
+	cache.rdb.Set(context.TODO(), k, toJson(&Dish{ID: 75, Name: "v2"}), 0)
+	for i := 0; i < 3; i++ {
+		var dish Dish
+		src, err := cache.GetWithSource(context.TODO(), "75", &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceRedis, src)
+		assert.Equal(t, "v2", dish.Name)
+	}
+	assert.Equal(t, []string{k, k, k}, counter.commands["get"])
+	// the local cache still follows the reads
+	var dish Dish
+	ok, err := cache.GetLocal("75", &dish)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", dish.Name)
+}
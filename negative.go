@@ -0,0 +1,82 @@
+package levelcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const defaultNegativeExpiration = time.Minute
+
+// negativeCache remembers the keys found nowhere until their expiration, apart from the local cache
+// so that a burst of missing keys never evicts values. Beyond size keys the oldest one goes first.
+type negativeCache struct {
+	mu   sync.Mutex
+	size int
+	ttl  time.Duration
+	// order lists the negativeEntry oldest first, entries indexes them by key
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type negativeEntry struct {
+	k     string
+	until time.Time
+}
+
+func newNegativeCache(size int, ttl time.Duration) *negativeCache {
+	return &negativeCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// add remembers k as missing from now on, evicting the oldest keys beyond size
+func (p *negativeCache) add(k string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[k]; ok {
+		p.order.Remove(e)
+	}
+	p.entries[k] = p.order.PushBack(negativeEntry{k: k, until: now.Add(p.ttl)})
+	for p.order.Len() > p.size {
+		oldest := p.order.Front()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(negativeEntry).k)
+	}
+}
+
+// has tells whether k is remembered as missing at now, forgetting it once expired
+func (p *negativeCache) has(k string, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.entries[k]
+	if !ok {
+		return false
+	}
+	if now.Before(e.Value.(negativeEntry).until) {
+		return true
+	}
+	p.order.Remove(e)
+	delete(p.entries, k)
+	return false
+}
+
+func (p *negativeCache) delete(k string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.entries[k]; ok {
+		p.order.Remove(e)
+		delete(p.entries, k)
+	}
+}
+
+func (p *negativeCache) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.order.Len()
+}
+
+func (p *negativeCache) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.order.Init()
+	p.entries = make(map[string]*list.Element)
+}
@@ -0,0 +1,53 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestLevelCache_NegativeCache(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:         "localhost:6379",
+		RedisPoolSize:     10,
+		NegativeCacheSize: 50,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := make(map[string]int)
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads[key]++
+		return GetDish(ctx, key)
+	})
+	ctx := context.TODO()
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "1", &dish))
+
+	// a flood of missing keys
+	for i := 0; i < 500; i++ {
+		key := "missing-" + strconv.Itoa(i)
+		cache.rdb.Del(ctx, cache.cacheKey("dish", key))
+		assert.True(t, errors.Is(cache.Get(ctx, key, &dish), ErrNotFound))
+	}
+	assert.Equal(t, 50, cache.negatives.len())
+	_, hot := cache.c.Get(cache.cacheKey("dish", "1"))
+	assert.True(t, hot)
+	assert.Equal(t, 1, cache.c.ItemCount())
+
+	// the latest missing keys are answered without loading, the oldest ones were forgotten
+	assert.True(t, errors.Is(cache.Get(ctx, "missing-499", &dish), ErrNotFound))
+	assert.Equal(t, 1, loads["missing-499"])
+	assert.True(t, errors.Is(cache.Get(ctx, "missing-0", &dish), ErrNotFound))
+	assert.Equal(t, 2, loads["missing-0"])
+	assert.True(t, errors.Is(cache.Get(ctx, "missing-499", &dish, ForceReload()), ErrNotFound))
+	assert.Equal(t, 2, loads["missing-499"])
+
+	// a value written afterwards is no longer missing
+	cache.negatives.add(cache.cacheKey("dish", "88"), cache.cfg.Clock.Now())
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 88}))
+	assert.False(t, cache.negatives.has(cache.cacheKey("dish", "88"), cache.cfg.Clock.Now()))
+}
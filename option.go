@@ -0,0 +1,82 @@
+package levelcache
+
+import "time"
+
+// GetOption tunes a single Get call
+type GetOption func(o *getOptions)
+
+type getOptions struct {
+	skipLocal   bool
+	forceReload bool
+	ttl         time.Duration
+	// def is served when the value is not found, cached for defaultTTL when positive
+	def        Cacheable
+	defaultTTL time.Duration
+	// noPopulateLocal serves local hits without writing the other reads to the local cache
+	noPopulateLocal bool
+	// seed replaces the loader, see GetOrSeed
+	seed Seed
+	// strict verifies local hits against the version in redis, see StrictConsistency
+	strict bool
+	// cachedOnly makes a miss of both levels return SourceNone without loading, fetch replaces the loader,
+	// see GetMany
+	cachedOnly bool
+	fetch      func(key string) (Cacheable, time.Duration, error)
+}
+
+func newGetOptions(opts []GetOption) getOptions {
+	var o getOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// StrictConsistency verifies a local hit against the version key in redis before serving it
+// and reads the value through again when another instance changed it, instead of waiting for
+// the update to be propagated. It costs a redis round trip on every local hit.
+func StrictConsistency() GetOption {
+	return func(o *getOptions) {
+		o.strict = true
+	}
+}
+
+// SkipLocal makes the call neither read nor write the local cache
+func SkipLocal() GetOption {
+	return func(o *getOptions) {
+		o.skipLocal = true
+	}
+}
+
+// NoPopulateLocal makes the call serve a local hit but never write the value it read from redis or loaded
+// to the local cache, so that one-shot scans do not evict the working set
+func NoPopulateLocal() GetOption {
+	return func(o *getOptions) {
+		o.noPopulateLocal = true
+	}
+}
+
+// ForceReload makes the call invoke the loader even on a hit and rewrite both levels with the result
+func ForceReload() GetOption {
+	return func(o *getOptions) {
+		o.forceReload = true
+	}
+}
+
+// WithTTL makes the values written by the call expire after ttl on both levels instead of their configured expiration,
+// NoExpiration makes them never expire
+func WithTTL(ttl time.Duration) GetOption {
+	return func(o *getOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithDefault makes the call fill the object with def instead of failing when the value is not found,
+// that is when no loader is registered or the loader returns an error wrapping ErrNotFound.
+// A positive ttl caches def for that long on both levels, zero leaves it uncached.
+func WithDefault(def Cacheable, ttl time.Duration) GetOption {
+	return func(o *getOptions) {
+		o.def = def
+		o.defaultTTL = ttl
+	}
+}
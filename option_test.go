@@ -0,0 +1,139 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_GetOption(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	k := cache.cacheKey("dish", "1")
+	cache.rdb.Del(context.TODO(), k)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Equal(t, 1, loads)
+
+	// skipping the local cache still hits redis
+	cache.c.Delete(k)
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish, SkipLocal()))
+	assert.Equal(t, 1, loads)
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+
+	// forcing a reload always calls the loader and bumps the version
+	before, _ := cache.currentVersion(context.TODO(), "dish", "1")
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish, ForceReload()))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish, ForceReload()))
+	assert.Equal(t, 3, loads)
+	after, _ := cache.currentVersion(context.TODO(), "dish", "1")
+	assert.Equal(t, before+2, after)
+
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish, ForceReload(), WithTTL(time.Minute)))
+	assert.Equal(t, 4, loads)
+	ttl, _ := cache.rdb.PTTL(context.TODO(), k).Result()
+	assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+	_, expiration, _ := cache.c.GetWithExpiration(k)
+	assert.InDelta(t, float64(time.Minute), float64(time.Until(expiration)), float64(time.Second))
+}
+
+func TestLevelCache_WithDefault(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	def := &Dish{Name: "unknown"}
+	k := cache.cacheKey("dish", "38")
+	cache.rdb.Del(ctx, k)
+
+	// no loader registered
+	var dish Dish
+	assert.True(t, errors.Is(cache.Get(ctx, "38", &dish), ErrNotFound))
+	assert.Nil(t, cache.Get(ctx, "38", &dish, WithDefault(def, 0)))
+	assert.Equal(t, "unknown", dish.Name)
+
+	loads, down := 0, false
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		if down {
+			return nil, errors.New("dish store down")
+		}
+		loads++
+		return GetDish(ctx, key)
+	})
+	dish = Dish{}
+	assert.Nil(t, cache.Get(ctx, "38", &dish, WithDefault(def, 0)))
+	assert.Equal(t, "unknown", dish.Name)
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, k).Val())
+
+	// a default with a ttl is cached on both levels
+	assert.Nil(t, cache.Get(ctx, "38", &dish, WithDefault(def, time.Minute)))
+	assert.Equal(t, 2, loads)
+	ttl, _ := cache.rdb.PTTL(ctx, k).Result()
+	assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+	dish = Dish{}
+	assert.Nil(t, cache.Get(ctx, "38", &dish))
+	assert.Equal(t, "unknown", dish.Name)
+	assert.Equal(t, 2, loads)
+	assert.Equal(t, uint64(3), cache.Stats().Defaults)
+
+	// other loader errors are still returned
+	down = true
+	cache.rdb.Del(ctx, k)
+	cache.c.Delete(k)
+	assert.NotNil(t, cache.Get(ctx, "38", &dish, WithDefault(def, 0)))
+}
+
+func TestLevelCache_NoPopulateLocal(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	ctx := context.TODO()
+	k := cache.cacheKey("dish", "2")
+	cache.rdb.Del(ctx, k)
+
+	// loaded then read from redis, never cached locally
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "2", &dish, NoPopulateLocal()))
+	assert.Equal(t, 2, dish.ID)
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+	dish = Dish{}
+	assert.Nil(t, cache.Get(ctx, "2", &dish, NoPopulateLocal()))
+	assert.Equal(t, 2, dish.ID)
+	_, ok = cache.c.Get(k)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), cache.Stats().RedisHits)
+
+	// a local entry is still served
+	assert.Nil(t, cache.Get(ctx, "2", &dish))
+	assert.Nil(t, cache.Get(ctx, "2", &dish, NoPopulateLocal()))
+	assert.Equal(t, uint64(1), cache.Stats().LocalHits)
+}
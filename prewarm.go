@@ -0,0 +1,87 @@
+package levelcache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// prewarmBatch is the most keys read by a single MGET of PrewarmLocal
+const prewarmBatch = 100
+
+// PrewarmLocal copies the values of keys from redis to the local cache along with their versions,
+// without calling the loader, so that a restarted instance serves them locally right away.
+// Local entries expire after LocalExpiration or when their redis value does, whichever comes first.
+// Keys missing from redis are skipped. Nothing is copied for namespaces with the local cache disabled.
+func (p *LevelCache) PrewarmLocal(ctx context.Context, namespace string, keys []string) error {
+	if p.localOnly() {
+		return ErrRedisDisabled
+	}
+	if p.namespaceConfig(namespace).localDisabled {
+		return nil
+	}
+	versioned := !p.versioningDisabled(namespace)
+	hashed := p.hashStorage(namespace)
+	for start := 0; start < len(keys); start += prewarmBatch {
+		batch := keys[start:]
+		if len(batch) > prewarmBatch {
+			batch = batch[:prewarmBatch]
+		}
+		dataKeys := make([]string, len(batch))
+		versionKeys := make([]string, len(batch))
+		for i, key := range batch {
+			dataKeys[i] = p.cacheKey(namespace, key)
+			versionKeys[i] = p.versionKey(namespace, key)
+		}
+		var (
+			contents, versions *redis.SliceCmd
+			pttls              = make([]*redis.DurationCmd, len(batch))
+		)
+		if _, err := p.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			if hashed {
+				contents = pipe.HMGet(ctx, p.hashKey(namespace), batch...)
+				// fields have no lifetime of their own, none outlives the hash
+				pttl := pipe.PTTL(ctx, p.hashKey(namespace))
+				for i := range pttls {
+					pttls[i] = pttl
+				}
+			} else {
+				contents = pipe.MGet(ctx, dataKeys...)
+				for i, k := range dataKeys {
+					pttls[i] = pipe.PTTL(ctx, k)
+				}
+			}
+			if versioned {
+				versions = pipe.MGet(ctx, versionKeys...)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for i, k := range dataKeys {
+			content, ok := contents.Val()[i].(string)
+			if !ok {
+				continue
+			}
+			if _, err := liveEntry(content); err != nil {
+				continue
+			}
+			// the local entry expires no later than the redis one
+			ttl := p.localExpiration(0)
+			if pttl := pttls[i].Val(); pttl > 0 && (ttl <= 0 || pttl < ttl) {
+				ttl = pttl
+			}
+			p.c.Set(k, content, ttl)
+			if !versioned {
+				continue
+			}
+			var v int64
+			if latest, ok := versions.Val()[i].(string); ok {
+				v, _ = strconv.ParseInt(latest, 10, 64)
+			}
+			p.setVersion(k, v)
+		}
+	}
+	return nil
+}
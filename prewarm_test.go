@@ -0,0 +1,59 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_PrewarmLocal(t *testing.T) {
+	writer, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	assert.Nil(t, writer.Set(ctx, &Dish{ID: 43, Name: "warm"}))
+	assert.Nil(t, writer.Set(ctx, &Dish{ID: 44, Name: "warm"}))
+	cache.rdb.Del(ctx, cache.cacheKey("dish", "45"))
+
+	assert.Nil(t, cache.PrewarmLocal(ctx, "dish", []string{"43", "44", "45"}))
+	_, ok := cache.c.Get(cache.cacheKey("dish", "45"))
+	assert.False(t, ok)
+	for _, key := range []string{"43", "44"} {
+		version, err := cache.currentVersion(ctx, "dish", key)
+		assert.Nil(t, err)
+		v, ok := cache.getVersion(cache.cacheKey("dish", key))
+		assert.True(t, ok)
+		assert.Equal(t, version, v)
+
+		var dish Dish
+		src, err := cache.GetWithSource(ctx, key, &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceLocal, src)
+		assert.Equal(t, "warm", dish.Name)
+	}
+	assert.Zero(t, loads)
+
+	// a value about to expire in redis is not kept locally any longer
+	assert.Nil(t, cache.rdb.PExpire(ctx, cache.cacheKey("dish", "44"), 200*time.Millisecond).Err())
+	cache.FlushLocal()
+	assert.Nil(t, cache.PrewarmLocal(ctx, "dish", []string{"43", "44"}))
+	_, expiration, ok := cache.c.GetWithExpiration(cache.cacheKey("dish", "44"))
+	assert.True(t, ok)
+	assert.True(t, time.Until(expiration) <= 200*time.Millisecond)
+	_, expiration, ok = cache.c.GetWithExpiration(cache.cacheKey("dish", "43"))
+	assert.True(t, ok)
+	assert.True(t, time.Until(expiration) > time.Second)
+}
@@ -0,0 +1,82 @@
+//go:build prometheus
+// +build prometheus
+
+package levelcache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	hitsDesc = prometheus.NewDesc("levelcache_hits_total",
+		"Reads served from a cache level.", []string{"level"}, nil)
+	missesDesc = prometheus.NewDesc("levelcache_misses_total",
+		"Reads missing both levels and served by the loader.", nil, nil)
+	errorsDesc = prometheus.NewDesc("levelcache_errors_total",
+		"Reads returning an error.", nil, nil)
+	loaderDesc = prometheus.NewDesc("levelcache_loader_duration_seconds",
+		"Latency of the data loaders.", nil, nil)
+	seedsDesc = prometheus.NewDesc("levelcache_seeds_total",
+		"Reads missing both levels and served by the seed of GetOrSeed.", nil, nil)
+	defaultsDesc = prometheus.NewDesc("levelcache_defaults_total",
+		"Reads missing both levels and served by the WithDefault object.", nil, nil)
+	droppedDesc = prometheus.NewDesc("levelcache_dropped_total",
+		"Version updates and events dropped on a full buffer.", []string{"kind"}, nil)
+	locksDesc = prometheus.NewDesc("levelcache_locks_acquired_total",
+		"Reload locks taken.", nil, nil)
+	lockFailuresDesc = prometheus.NewDesc("levelcache_lock_failures_total",
+		"Attempts to take a reload lock failing on a held lock.", nil, nil)
+	lockWaitDesc = prometheus.NewDesc("levelcache_lock_wait_seconds_total",
+		"Time spent waiting for the reload locks.", nil, nil)
+	versionErrorsDesc = prometheus.NewDesc("levelcache_version_check_errors_total",
+		"Versions of local hits which could not be read from redis.", nil, nil)
+)
+
+// collector exports the counters and loader latencies of a cache
+type collector struct {
+	cache *LevelCache
+}
+
+// Collector returns a prometheus.Collector of the cache metrics, only built with the prometheus tag.
+func (p *LevelCache) Collector() prometheus.Collector {
+	return collector{cache: p}
+}
+
+func (p collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hitsDesc
+	ch <- missesDesc
+	ch <- errorsDesc
+	ch <- loaderDesc
+	ch <- seedsDesc
+	ch <- defaultsDesc
+	ch <- droppedDesc
+	ch <- locksDesc
+	ch <- lockFailuresDesc
+	ch <- lockWaitDesc
+	ch <- versionErrorsDesc
+}
+
+func (p collector) Collect(ch chan<- prometheus.Metric) {
+	s := p.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.LocalHits), "local")
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.RedisHits), "redis")
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.StaleHits), "stale")
+	ch <- prometheus.MustNewConstMetric(missesDesc, prometheus.CounterValue, float64(s.Loads))
+	ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(s.Errors))
+	ch <- prometheus.MustNewConstMetric(seedsDesc, prometheus.CounterValue, float64(s.Seeds))
+	ch <- prometheus.MustNewConstMetric(defaultsDesc, prometheus.CounterValue, float64(s.Defaults))
+	ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(s.DroppedUpdates), "update")
+	ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(s.DroppedEvents), "event")
+	ch <- prometheus.MustNewConstMetric(locksDesc, prometheus.CounterValue, float64(s.LocksAcquired))
+	ch <- prometheus.MustNewConstMetric(lockFailuresDesc, prometheus.CounterValue, float64(s.LockFailures))
+	ch <- prometheus.MustNewConstMetric(lockWaitDesc, prometheus.CounterValue, s.LockWait.Seconds())
+	ch <- prometheus.MustNewConstMetric(versionErrorsDesc, prometheus.CounterValue, float64(s.VersionCheckErrors))
+
+	h := p.cache.stats.loaderLatency()
+	buckets := make(map[float64]uint64, len(loaderBuckets))
+	var count uint64
+	for i, bound := range loaderBuckets {
+		count += h.counts[i]
+		buckets[bound.Seconds()] = count
+	}
+	count += h.counts[len(loaderBuckets)]
+	ch <- prometheus.MustNewConstHistogram(loaderDesc, count, h.sum.Seconds(), buckets)
+}
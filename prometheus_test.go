@@ -0,0 +1,68 @@
+//go:build prometheus
+// +build prometheus
+
+package levelcache
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_Collector(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "1"))
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish))
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "106"), cache.cacheKey("dish", "107"))
+	assert.Nil(t, cache.GetOrSeed(context.TODO(), "106", &dish, func(ctx context.Context, key string) ([]byte, error) {
+		return []byte(`{"id":106}`), nil
+	}))
+	assert.Nil(t, cache.Get(context.TODO(), "107", &dish, WithDefault(&Dish{Name: "unknown"}, 0)))
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(cache.Collector()))
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				name := family.GetName()
+				for _, label := range m.GetLabel() {
+					name += "/" + label.GetValue()
+				}
+				values[name] = m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				values[family.GetName()] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"levelcache_hits_total/local":           1,
+		"levelcache_hits_total/redis":           0,
+		"levelcache_hits_total/stale":           0,
+		"levelcache_misses_total":               1,
+		"levelcache_errors_total":               0,
+		"levelcache_loader_duration_seconds":    2,
+		"levelcache_seeds_total":                1,
+		"levelcache_defaults_total":             1,
+		"levelcache_dropped_total/update":       0,
+		"levelcache_dropped_total/event":        0,
+		"levelcache_locks_acquired_total":       0,
+		"levelcache_lock_failures_total":        0,
+		"levelcache_lock_wait_seconds_total":    0,
+		"levelcache_version_check_errors_total": 0,
+	}, values)
+}
@@ -0,0 +1,87 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReloadNamespace replaces the loader of namespace, registering it when there was none, and removes the values
+// of the namespace from redis and the local cache so that every value is loaded again by the new loader.
+// While they are removed the values of the namespace are served by the new loader without being cached,
+// though a load the previous loader already started may still write its value afterwards.
+// A BatchDataLoader registered for the namespace is unregistered and so is the type recorded by RegisterTypedLoader.
+// Redis values are removed like ClearNamespace with HashStorage and like DeleteByPattern otherwise,
+// a custom KeyEncoder cannot tell the namespace of local entries so the whole local cache is flushed.
+// The loader is replaced even when removing the values fails.
+func (p *LevelCache) ReloadNamespace(ctx context.Context, namespace string, loader DataLoader) error {
+	if namespace == "" {
+		return fmt.Errorf("empty namespace of data loader")
+	}
+	if err := checkReservedNamespace(namespace); err != nil {
+		return err
+	}
+	var removed [][2]string
+	deleted := func(namespace, key string) {
+		removed = append(removed, [2]string{namespace, key})
+	}
+	p.lmu.Lock()
+	p.loaders[namespace] = withDefaultTTL(loader)
+	delete(p.batches, namespace)
+	delete(p.types, namespace)
+	p.reloads[namespace]++
+	p.lmu.Unlock()
+	var err error
+	switch {
+	case p.localOnly():
+		// nothing but the local cache to clear
+	case p.hashStorage(namespace):
+		err = p.clearNamespace(ctx, namespace, deleted)
+	default:
+		_, err = p.deleteByPattern(ctx, p.namespacePattern(namespace), deleted)
+	}
+	// evicted once redis misses the values so that no read puts them back
+	p.evictNamespace(namespace)
+	p.lmu.Lock()
+	p.reloads[namespace]--
+	if p.reloads[namespace] == 0 {
+		delete(p.reloads, namespace)
+	}
+	p.lmu.Unlock()
+	// callbacks run once the namespace is cached again, they may read it
+	for _, r := range removed {
+		p.invalidated(EventDelete, r[0], r[1])
+	}
+	if err != nil {
+		return fmt.Errorf("reload [%s] fail: %w", namespace, err)
+	}
+	return nil
+}
+
+// evictNamespace removes the local entries of namespace and their versions
+func (p *LevelCache) evictNamespace(namespace string) {
+	if _, ok := p.cfg.KeyEncoder.(keySplitter); !ok {
+		p.FlushLocal()
+		return
+	}
+	var evicted []string
+	p.c.DeleteIf(func(k string) bool {
+		parts, ok := p.splitKey(k)
+		if ok && len(parts) == 2 && parts[0] == namespace {
+			evicted = append(evicted, k)
+			return true
+		}
+		return false
+	})
+	p.vmu.Lock()
+	for _, k := range evicted {
+		delete(p.version, k)
+	}
+	p.vmu.Unlock()
+}
+
+// reloading reports whether ReloadNamespace is removing the values of namespace
+func (p *LevelCache) reloading(namespace string) bool {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	return p.reloads[namespace] > 0
+}
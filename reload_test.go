@@ -0,0 +1,193 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestLevelCache_ReloadNamespace(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 68, Name: "old logic"}, nil
+	})
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "68"))
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "68", &dish))
+	assert.Equal(t, "old logic", dish.Name)
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 69, Name: "old logic"}))
+	var drink Drink
+	assert.Nil(t, cache.Set(context.TODO(), &Drink{ID: 68, Name: "kept"}))
+
+	err = cache.ReloadNamespace(context.TODO(), "dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 68, Name: "new logic"}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cache.rdb.Exists(context.TODO(), cache.cacheKey("dish", "68"), cache.cacheKey("dish", "69")).Val())
+	for _, key := range []string{"68", "69"} {
+		src, err := cache.GetWithSource(context.TODO(), key, &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceLoader, src)
+		assert.Equal(t, "new logic", dish.Name)
+	}
+	// other namespaces are left alone
+	src, err := cache.GetWithSource(context.TODO(), "68", &drink)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLocal, src)
+	assert.Equal(t, "kept", drink.Name)
+}
+
+// scanBlockHook holds the first SCAN until release is closed, reporting it on scanning
+type scanBlockHook struct {
+	once     *sync.Once
+	scanning chan struct{}
+	release  chan struct{}
+}
+
+func (h scanBlockHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "scan" {
+		h.once.Do(func() {
+			close(h.scanning)
+			<-h.release
+		})
+	}
+	return ctx, nil
+}
+
+func (scanBlockHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (scanBlockHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (scanBlockHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_ReloadNamespaceScan(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	_ = cache.RegisterLoader("dish", GetDish)
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 92, Name: "old logic"}))
+	assert.Nil(t, cache.Set(ctx, &Drink{ID: 92, Name: "kept"}))
+	hook := scanBlockHook{once: &sync.Once{}, scanning: make(chan struct{}), release: make(chan struct{})}
+	cache.rdb.AddHook(hook)
+
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- cache.ReloadNamespace(ctx, "dish", func(ctx context.Context, key string) (Cacheable, error) {
+			return &Dish{ID: 92, Name: "new logic"}, nil
+		})
+	}()
+	<-hook.scanning
+
+	// the scan holds no lock, other namespaces are read as usual
+	var drink Drink
+	src, err := cache.GetWithSource(ctx, "92", &drink)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLocal, src)
+	// the namespace being reloaded is served by the new loader, caching nothing
+	var dish Dish
+	src, err = cache.GetWithSource(ctx, "92", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLoader, src)
+	assert.Equal(t, "new logic", dish.Name)
+	content, err := cache.rdb.Get(ctx, cache.cacheKey("dish", "92")).Result()
+	assert.Nil(t, err)
+	assert.Contains(t, content, "old logic")
+
+	close(hook.release)
+	assert.Nil(t, <-reloaded)
+	src, err = cache.GetWithSource(ctx, "92", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLoader, src)
+	src, err = cache.GetWithSource(ctx, "92", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLocal, src)
+	assert.Equal(t, "new logic", dish.Name)
+}
+
+// versionedDish lives in a namespace holding the first byte of the key separator
+type versionedDish struct {
+	Dish
+}
+
+func (p *versionedDish) Namespace() string {
+	return "dish#v2"
+}
+
+func TestLevelCache_ReloadNamespacePattern(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	assert.Nil(t, cache.Set(ctx, &versionedDish{Dish{ID: 93}}))
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 93}))
+	assert.Equal(t, `dish\\#v2#$#*`, cache.namespacePattern("dish#v2"))
+	assert.Equal(t, `d\*#$#*`, cache.namespacePattern("d*"))
+
+	keys, err := cache.rdb.Keys(ctx, cache.namespacePattern("dish#v2")).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{cache.cacheKey("dish#v2", "93")}, keys)
+	assert.Nil(t, cache.ReloadNamespace(ctx, "dish#v2", GetDish))
+	assert.Equal(t, int64(0), cache.rdb.Exists(ctx, cache.cacheKey("dish#v2", "93")).Val())
+
+	// glob characters only match themselves
+	assert.Nil(t, cache.ReloadNamespace(ctx, "d*", GetDish))
+	assert.Equal(t, int64(1), cache.rdb.Exists(ctx, cache.cacheKey("dish", "93")).Val())
+}
+
+// menuDish shares the namespace of Dish under another type
+type menuDish struct {
+	Dish
+}
+
+func TestLevelCache_ReloadNamespaceType(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	assert.Nil(t, cache.RegisterTypedLoader(&Dish{}, GetDish))
+	cache.rdb.Del(ctx, cache.cacheKey("dish", "102"))
+	var menu menuDish
+	assert.True(t, errors.Is(cache.Get(ctx, "102", &menu), ErrTypeMismatch))
+
+	// the new loader is not bound to the type of the previous one
+	assert.Nil(t, cache.ReloadNamespace(ctx, "dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &menuDish{Dish{ID: 102, Name: "menu"}}, nil
+	}))
+	assert.Nil(t, cache.Get(ctx, "102", &menu))
+	assert.Equal(t, "menu", menu.Name)
+}
+
+func TestLevelCache_ReservedNamespace(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	for _, namespace := range []string{"hash", "version", "stale", "lock", "history"} {
+		assert.True(t, errors.Is(cache.RegisterLoader(namespace, GetDish), ErrReservedNamespace))
+		assert.True(t, errors.Is(cache.RegisterBatchLoader(namespace, nil), ErrReservedNamespace))
+		assert.True(t, errors.Is(cache.ReloadNamespace(context.TODO(), namespace, GetDish), ErrReservedNamespace))
+	}
+	cache.RegisterLoaders(map[string]DataLoader{"version": GetDish, "dish": GetDish})
+	assert.Equal(t, []string{"dish"}, cache.Namespaces())
+}
@@ -0,0 +1,38 @@
+package levelcache
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// dialReplicas connects to every ReadReplicaAddrs, closing them all if one is unreachable
+func dialReplicas(cfg CacheConfig) ([]*redis.Client, error) {
+	replicas := make([]*redis.Client, 0, len(cfg.ReadReplicaAddrs))
+	for _, addr := range cfg.ReadReplicaAddrs {
+		replica := redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDb,
+			PoolSize: cfg.RedisPoolSize,
+		})
+		replicas = append(replicas, replica)
+		if err := replica.Ping(context.TODO()).Err(); err != nil {
+			for _, r := range replicas {
+				_ = r.Close()
+			}
+			return nil, err
+		}
+	}
+	return replicas, nil
+}
+
+// reader returns the client of the next read, a replica when there are some and the primary otherwise
+func (p *LevelCache) reader() *redis.Client {
+	if len(p.replicas) == 0 {
+		return p.rdb
+	}
+	n := atomic.AddUint32(&p.next, 1)
+	return p.replicas[n%uint32(len(p.replicas))]
+}
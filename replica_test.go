@@ -0,0 +1,145 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// laggingHook makes every GET of a replica miss, as if the replica had not caught up yet
+type laggingHook struct {
+	gets int
+}
+
+func (p *laggingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "get" {
+		p.gets++
+		return ctx, redis.Nil
+	}
+	return ctx, nil
+}
+
+func (p *laggingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (p *laggingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (p *laggingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_ReplicaLag(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:        "localhost:6379",
+		RedisPoolSize:    10,
+		ReadReplicaAddrs: []string{"localhost:6379"},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	hook := &laggingHook{}
+	cache.replicas[0].AddHook(hook)
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	cache.rdb.Set(context.TODO(), cache.cacheKey("dish", "1"), toJson(&Dish{ID: 1, Name: "primary"}), 0)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "1", &dish, SkipLocal()))
+	assert.Equal(t, "primary", dish.Name)
+	assert.Equal(t, 0, loads)
+	assert.True(t, hook.gets > 0)
+}
+
+// staleHook makes a replica read the keys of stale instead of the requested ones, as if it had not caught up yet
+type staleHook struct {
+	stale map[string]string
+}
+
+func (p *staleHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if args := cmd.Args(); cmd.Name() == "get" && len(args) == 2 {
+		if k, ok := p.stale[args[1].(string)]; ok {
+			args[1] = k
+		}
+	}
+	return ctx, nil
+}
+
+func (p *staleHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (p *staleHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (p *staleHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_ReplicaVersionLag(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:        "localhost:6379",
+		RedisPoolSize:    10,
+		ReadReplicaAddrs: []string{"localhost:6379"},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	ctx := context.TODO()
+	k, vk := cache.cacheKey("dish", "97"), cache.versionKey("dish", "97")
+	staleK, staleVK := cache.cacheKey("stale-replica", k), cache.cacheKey("stale-replica", vk)
+	cache.rdb.Del(ctx, k, vk)
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 97, Name: "replaced"}))
+	content, _ := cache.rdb.Get(ctx, k).Result()
+	version, _ := cache.rdb.Get(ctx, vk).Result()
+	cache.rdb.Set(ctx, staleK, content, 0)
+	cache.rdb.Set(ctx, staleVK, version, 0)
+	cache.replicas[0].AddHook(&staleHook{stale: map[string]string{k: staleK, vk: staleVK}})
+
+	// the replica still serves the value replaced by the version this instance wrote
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 97, Name: "current"}))
+	cache.SetAlwaysReadRedis("dish", true)
+	var dish Dish
+	src, err := cache.GetWithSource(ctx, "97", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceRedis, src)
+	assert.Equal(t, "current", dish.Name)
+	replica, _ := cache.replicas[0].Get(ctx, k).Result()
+	assert.Equal(t, content, replica)
+}
+
+func TestLevelCache_ReadReplica(t *testing.T) {
+	addr := os.Getenv("LEVELCACHE_REPLICA_ADDR")
+	if addr == "" {
+		t.Skip("LEVELCACHE_REPLICA_ADDR is not set")
+	}
+	cache, err := New(CacheConfig{
+		RedisAddr:        "localhost:6379",
+		RedisPoolSize:    10,
+		ReadReplicaAddrs: []string{addr},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	defer cache.Close()
+	_ = cache.RegisterLoader("dish", GetDish)
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 2, Name: "replicated"}))
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "2", &dish, SkipLocal()))
+	assert.Equal(t, "replicated", dish.Name)
+	assert.Equal(t, cache.replicas[0], cache.reader())
+}
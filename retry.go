@@ -0,0 +1,90 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultRedisMaxRetries = 2
+	minRetryBackoff        = 8 * time.Millisecond
+	maxRetryBackoff        = 256 * time.Millisecond
+)
+
+// getRedis reads and decodes key of namespace from redis, retrying transient failures up to RedisMaxRetries times.
+// A replica missing the key may only lag behind, the primary confirms the miss. A replica behind the version
+// this instance already knows of would serve the value that version replaced, the primary is read instead.
+// A replica still serves a replaced value for as long as it lags when no version of the key is known,
+// e.g. once its local entry expired.
+func (p *LevelCache) getRedis(ctx context.Context, namespace, key string) (string, error) {
+	rdb := p.reader()
+	if rdb != p.rdb && p.replicaBehind(ctx, rdb, namespace, key) {
+		rdb = p.rdb
+	}
+	content, err := p.getEntry(ctx, rdb, namespace, key).Result()
+	for attempt := 0; attempt < p.cfg.RedisMaxRetries && isRetryable(err); attempt++ {
+		select {
+		case <-p.cfg.Clock.After(retryBackoff(attempt)):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		content, err = p.getEntry(ctx, rdb, namespace, key).Result()
+	}
+	if err == redis.Nil && rdb != p.rdb {
+		content, err = p.getEntry(ctx, p.rdb, namespace, key).Result()
+	}
+	if err != nil {
+		return "", err
+	}
+	return liveEntry(content)
+}
+
+// replicaBehind reports whether the version of key on replica is older than the one this instance knows of,
+// or cannot be read. The version is read before the value so that the value is at least as recent.
+func (p *LevelCache) replicaBehind(ctx context.Context, replica *redis.Client, namespace, key string) bool {
+	known, ok := p.getVersion(p.cacheKey(namespace, key))
+	if !ok || known == 0 || p.versioningDisabled(namespace) {
+		return false
+	}
+	version, err := replica.Get(ctx, p.versionKey(namespace, key)).Int64()
+	if err == redis.Nil {
+		return true
+	}
+	return err != nil || version < known
+}
+
+// retryBackoff doubles from minRetryBackoff up to maxRetryBackoff, keeping half of it as jitter
+func retryBackoff(attempt int) time.Duration {
+	d := minRetryBackoff << uint(attempt)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// isRetryable tells network failures and temporary redis states from permanent errors
+func isRetryable(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "LOADING ") || strings.HasPrefix(msg, "TRYAGAIN ") || strings.HasPrefix(msg, "CLUSTERDOWN ")
+}
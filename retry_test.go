@@ -0,0 +1,183 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyHook fails the first failures GET commands with a connection reset
+type flakyHook struct {
+	failures int
+	gets     int
+}
+
+func (p *flakyHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() != "get" {
+		return ctx, nil
+	}
+	p.gets++
+	if p.gets <= p.failures {
+		return ctx, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	return ctx, nil
+}
+
+func (p *flakyHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (p *flakyHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (p *flakyHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_RedisRetry(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	k := cache.cacheKey("dish", "1")
+	cache.rdb.Set(context.TODO(), k, toJson(&Dish{ID: 1, Name: "cached"}), 0)
+
+	hook := &flakyHook{failures: 1}
+	cache.rdb.AddHook(hook)
+	var dish Dish
+	if err := cache.Get(context.TODO(), "1", &dish); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.Equal(t, "cached", dish.Name)
+	assert.Equal(t, 0, loads)
+
+	// redis keeps failing, the loader serves the value
+	cache.c.Delete(k)
+	hook.failures, hook.gets = 100, 0
+	if err := cache.Get(context.TODO(), "1", &dish); err != nil {
+		t.Errorf("get cache fail:%+v", err)
+		return
+	}
+	assert.Equal(t, "GongBaoJiDing", dish.Name)
+	assert.Equal(t, 1, loads)
+
+	assert.True(t, isRetryable(&net.OpError{Op: "read", Err: syscall.ECONNRESET}))
+	assert.False(t, isRetryable(redis.Nil))
+	assert.False(t, isRetryable(context.Canceled))
+}
+
+// readOnlyHook fails every SET and script like a replica promoted read only
+type readOnlyHook struct{}
+
+func (readOnlyHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	switch cmd.Name() {
+	case "set", "eval", "evalsha":
+		return ctx, errors.New("READONLY You can't write against a read only replica.")
+	}
+	return ctx, nil
+}
+
+func (readOnlyHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (readOnlyHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (readOnlyHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestLevelCache_WriteErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy WriteErrorPolicy
+		fail   bool
+		logs   int
+	}{
+		{policy: WriteErrorLog, logs: 1},
+		{policy: WriteErrorIgnore},
+		{policy: WriteErrorReturn, fail: true},
+	} {
+		var logger recordLogger
+		cache, err := New(CacheConfig{
+			RedisAddr:        "localhost:6379",
+			RedisPoolSize:    10,
+			WriteErrorPolicy: tc.policy,
+			Logger:           &logger,
+		})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		_ = cache.RegisterLoader("dish", GetDish)
+		cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "2"))
+		cache.rdb.AddHook(readOnlyHook{})
+
+		var dish Dish
+		err = cache.Get(context.TODO(), "2", &dish)
+		if tc.fail {
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "READONLY")
+			_, ok := cache.c.Get(cache.cacheKey("dish", "2"))
+			assert.False(t, ok)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, 2, dish.ID)
+		}
+		assert.Len(t, logger, tc.logs)
+	}
+}
+
+func TestLevelCache_WriteErrorPolicyDefault(t *testing.T) {
+	for _, tc := range []struct {
+		policy WriteErrorPolicy
+		fail   bool
+		logs   int
+	}{
+		{policy: WriteErrorLog, logs: 1},
+		{policy: WriteErrorReturn, fail: true},
+	} {
+		var logger recordLogger
+		cache, err := New(CacheConfig{
+			RedisAddr:        "localhost:6379",
+			RedisPoolSize:    10,
+			WriteErrorPolicy: tc.policy,
+			Logger:           &logger,
+		})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "101"))
+		cache.rdb.AddHook(readOnlyHook{})
+
+		// no loader, the default is cached for a minute
+		var dish Dish
+		err = cache.Get(context.TODO(), "101", &dish, WithDefault(&Dish{Name: "unknown"}, time.Minute))
+		if tc.fail {
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "READONLY")
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, "unknown", dish.Name)
+		}
+		assert.Len(t, logger, tc.logs)
+	}
+}
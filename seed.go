@@ -0,0 +1,40 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+)
+
+// Seed supplies the value of key already serialized by the Serializer of its namespace,
+// e.g. a JSON blob fetched from a CDN. It wraps ErrNotFound for keys it has no value for.
+type Seed func(ctx context.Context, key string) ([]byte, error)
+
+// GetOrSeed works like Get but fills a value missing from both levels with the bytes returned by seed
+// instead of calling the loader, writing them to both levels as they are.
+func (p *LevelCache) GetOrSeed(ctx context.Context, key string, obj Cacheable, seed Seed) error {
+	if err := checkObject(obj, true); err != nil {
+		return err
+	}
+	if seed == nil {
+		return fmt.Errorf("%w: nil seed", ErrNilObject)
+	}
+	p.checkCacheUpdate(ctx, obj.Namespace(), key)
+	_, err := p.get(ctx, key, obj, getOptions{seed: seed})
+	return err
+}
+
+// seed fills obj with the bytes returned by seed and returns the entry to store them as
+func (p *LevelCache) seed(ctx context.Context, key string, obj Cacheable, seed Seed) (string, error) {
+	payload, err := seed(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("seed [%s] key [%s] fail: %w", obj.Namespace(), key, err)
+	}
+	content, err := p.wrap(obj.Namespace(), p.serializer(obj.Namespace()), payload)
+	if err != nil {
+		return "", err
+	}
+	if err := p.unmarshal(obj.Namespace(), content, obj); err != nil {
+		return "", fmt.Errorf("seed [%s] key [%s]: %w", obj.Namespace(), key, err)
+	}
+	return content, p.validate(obj.Namespace(), key, obj)
+}
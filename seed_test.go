@@ -0,0 +1,61 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_GetOrSeed(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	seeds := 0
+	seed := func(ctx context.Context, key string) ([]byte, error) {
+		seeds++
+		if key != "49" {
+			return nil, ErrNotFound
+		}
+		return []byte(`{"id":49,"name":"seeded"}`), nil
+	}
+	k := cache.cacheKey("dish", "49")
+	cache.rdb.Del(ctx, k, cache.cacheKey("dish", "50"))
+
+	var dish Dish
+	assert.Nil(t, cache.GetOrSeed(ctx, "49", &dish, seed))
+	assert.Equal(t, Dish{ID: 49, Name: "seeded"}, dish)
+	content, err := cache.rdb.Get(ctx, k).Result()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"id":49,"name":"seeded"}`, content)
+	_, ok := cache.c.Get(k)
+	assert.True(t, ok)
+
+	// hits never call the seed
+	cache.c.Delete(k)
+	dish = Dish{}
+	assert.Nil(t, cache.GetOrSeed(ctx, "49", &dish, seed))
+	assert.Equal(t, "seeded", dish.Name)
+	assert.Nil(t, cache.Get(ctx, "49", &dish))
+	assert.Equal(t, 1, seeds)
+	assert.Zero(t, loads)
+	assert.Equal(t, uint64(1), cache.Stats().Seeds)
+
+	assert.True(t, errors.Is(cache.GetOrSeed(ctx, "50", &dish, seed), ErrNotFound))
+	assert.NotNil(t, cache.GetOrSeed(ctx, "50", &dish, func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("not json"), nil
+	}))
+	_, ok = cache.c.Get(cache.cacheKey("dish", "50"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,111 @@
+package levelcache
+
+import (
+	"fmt"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Serializer converts the cached objects to the payloads stored in redis and back.
+// ID tags the payloads it produced, so they keep being decoded by it after the serializer of a namespace changed,
+// zero is reserved to JSONSerializer.
+type Serializer interface {
+	ID() byte
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonSerializer struct{}
+
+// JSONSerializer is the default Serializer, its values are stored as bare JSON readable by any consumer.
+// It is deterministic: map keys are sorted and struct fields follow their declaration,
+// so the same value always gives the same bytes, which keeps the levels comparable byte for byte.
+var JSONSerializer Serializer = jsonSerializer{}
+
+// stableJSON is jsoniter sorting map keys, which it otherwise writes in map iteration order
+var stableJSON = jsoniter.Config{EscapeHTML: true, SortMapKeys: true}.Froze()
+
+func (jsonSerializer) ID() byte {
+	return 0
+}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return stableJSON.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return stableJSON.Unmarshal(data, v)
+}
+
+// SetNamespaceSerializer makes the namespace store its values with s instead of the Serializer of the config,
+// nil restores it. Values written before keep being read with their own serializer.
+func (p *LevelCache) SetNamespaceSerializer(namespace string, s Serializer) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.serializer = s
+	})
+	if s != nil {
+		p.nsmu.Lock()
+		p.serializers[s.ID()] = s
+		p.nsmu.Unlock()
+	}
+}
+
+func (p *LevelCache) serializer(namespace string) Serializer {
+	if s := p.namespaceConfig(namespace).serializer; s != nil {
+		return s
+	}
+	return p.cfg.Serializer
+}
+
+// Migrate upgrades the payload of a value written with the older schema version oldVersion
+// to the current schema of its namespace, the payload being in the format of the Serializer which wrote it.
+type Migrate func(oldVersion int, raw []byte) ([]byte, error)
+
+// SetNamespaceSchema tags the values written for the namespace with the schema version,
+// values read with an older version are passed to migrate before being decoded.
+// Values written before any schema was set have version zero. Migrated values are not written back,
+// they are migrated on every read until rewritten. A nil migrate decodes old values as they are.
+func (p *LevelCache) SetNamespaceSchema(namespace string, version int, migrate Migrate) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.schema = version
+		cfg.migrate = migrate
+	})
+}
+
+// marshal serializes obj into the entry stored for namespace
+func (p *LevelCache) marshal(namespace string, obj interface{}) (string, error) {
+	s := p.serializer(namespace)
+	payload, err := s.Marshal(serialized(obj))
+	if err != nil {
+		return "", err
+	}
+	return p.wrap(namespace, s, payload)
+}
+
+// wrap builds the entry stored for namespace from a payload serialized by s
+func (p *LevelCache) wrap(namespace string, s Serializer, payload []byte) (string, error) {
+	e := Envelope{Serializer: s.ID(), Schema: p.namespaceConfig(namespace).schema, Payload: payload}
+	entry, err := encodeEnvelope(e, p.cfg.Encryptor)
+	return string(entry), err
+}
+
+// unmarshal decodes an entry of namespace into obj with the serializer which produced it,
+// migrating it first when written with an older schema
+func (p *LevelCache) unmarshal(namespace, entry string, obj interface{}) error {
+	e, err := decodeEnvelope([]byte(entry), p.cfg.Encryptor)
+	if err != nil {
+		return err
+	}
+	p.nsmu.RLock()
+	s, ok := p.serializers[e.Serializer]
+	p.nsmu.RUnlock()
+	if !ok {
+		return fmt.Errorf("serializer %d unknown, see ReadSerializers: %w", e.Serializer, ErrInvalidEnvelope)
+	}
+	if cfg := p.namespaceConfig(namespace); e.Schema < cfg.schema && cfg.migrate != nil {
+		if e.Payload, err = cfg.migrate(e.Schema, e.Payload); err != nil {
+			return fmt.Errorf("migrate [%s] from schema %d: %w", namespace, e.Schema, err)
+		}
+	}
+	return s.Unmarshal(e.Payload, serialized(obj))
+}
@@ -0,0 +1,206 @@
+package levelcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"testing"
+)
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) ID() byte {
+	return 1
+}
+
+func (msgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+func TestLevelCache_SetNamespaceSerializer(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache.SetNamespaceSerializer("drink", msgpackSerializer{})
+	ctx := context.TODO()
+
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 36, Name: "json"}))
+	assert.Nil(t, cache.Set(ctx, &Drink{ID: 36, Name: "msgpack"}))
+
+	entry, err := cache.rdb.Get(ctx, cache.cacheKey("dish", "36")).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, toJson(&Dish{ID: 36, Name: "json"}), entry)
+	entry, err = cache.rdb.Get(ctx, cache.cacheKey("drink", "36")).Result()
+	assert.Nil(t, err)
+	e, err := DecodeEnvelope([]byte(entry))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(1), e.Serializer)
+	assert.True(t, e.Flags&FlagSerializer != 0)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "36", &dish, SkipLocal()))
+	assert.Equal(t, "json", dish.Name)
+	var drink Drink
+	assert.Nil(t, cache.Get(ctx, "36", &drink, SkipLocal()))
+	assert.Equal(t, "msgpack", drink.Name)
+	assert.Nil(t, cache.Get(ctx, "36", &drink))
+	assert.Equal(t, "msgpack", drink.Name)
+
+	// values written before switching back to the default keep decoding with msgpack
+	cache.SetNamespaceSerializer("drink", nil)
+	drink = Drink{}
+	assert.Nil(t, cache.Get(ctx, "36", &drink, SkipLocal()))
+	assert.Equal(t, "msgpack", drink.Name)
+	assert.Nil(t, cache.Set(ctx, &Drink{ID: 36, Name: "json"}))
+	entry, _ = cache.rdb.Get(ctx, cache.cacheKey("drink", "36")).Result()
+	assert.Equal(t, toJson(&Drink{ID: 36, Name: "json"}), entry)
+
+	// an unknown serializer can not be decoded
+	unknown, _ := EncodeEnvelope(Envelope{Serializer: 9, Payload: []byte("{}")})
+	assert.True(t, errors.Is(cache.unmarshal(drink.Namespace(), string(unknown), &drink), ErrInvalidEnvelope))
+}
+
+func TestLevelCache_ReadSerializers(t *testing.T) {
+	// nodes on both sides of a rolling deploy from JSON to msgpack
+	msgpackNode, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		Serializer:    msgpackSerializer{},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	jsonNode, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		ReadSerializers: []Serializer{msgpackSerializer{}},
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+
+	assert.Nil(t, msgpackNode.Set(ctx, &Drink{ID: 85, Name: "msgpack"}))
+	assert.Nil(t, jsonNode.Set(ctx, &Drink{ID: 86, Name: "json"}))
+	entry, _ := jsonNode.rdb.Get(ctx, jsonNode.cacheKey("drink", "86")).Result()
+	assert.Equal(t, toJson(&Drink{ID: 86, Name: "json"}), entry)
+
+	var drink Drink
+	assert.Nil(t, jsonNode.Get(ctx, "85", &drink))
+	assert.Equal(t, "msgpack", drink.Name)
+	assert.Nil(t, msgpackNode.Get(ctx, "86", &drink))
+	assert.Equal(t, "json", drink.Name)
+
+	// a node not told about msgpack can not read its values
+	legacy, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.True(t, errors.Is(legacy.Get(ctx, "85", &drink), ErrInvalidEnvelope))
+}
+
+func TestLevelCache_SetNamespaceSchema(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	// schema 1 named the field title
+	v1, err := EncodeEnvelope(Envelope{Schema: 1, Payload: []byte(`{"id":37,"title":"cola"}`)})
+	assert.Nil(t, err)
+	e, err := DecodeEnvelope(v1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, e.Schema)
+	assert.True(t, e.Flags&FlagSchema != 0)
+	k := cache.cacheKey("drink", "37")
+	cache.rdb.Set(ctx, k, v1, 0)
+
+	migrations := 0
+	cache.SetNamespaceSchema("drink", 2, func(oldVersion int, raw []byte) ([]byte, error) {
+		migrations++
+		assert.Equal(t, 1, oldVersion)
+		return bytes.Replace(raw, []byte(`"title"`), []byte(`"name"`), 1), nil
+	})
+	var drink Drink
+	assert.Nil(t, cache.Get(ctx, "37", &drink, SkipLocal()))
+	assert.Equal(t, Drink{ID: 37, Name: "cola"}, drink)
+	assert.Equal(t, 1, migrations)
+
+	// values written with the current schema are decoded as they are
+	assert.Nil(t, cache.Set(ctx, &Drink{ID: 37, Name: "tea"}))
+	entry, _ := cache.rdb.Get(ctx, k).Result()
+	e, err = DecodeEnvelope([]byte(entry))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, e.Schema)
+	assert.Nil(t, cache.Get(ctx, "37", &drink, SkipLocal()))
+	assert.Equal(t, "tea", drink.Name)
+	assert.Equal(t, 1, migrations)
+
+	cache.rdb.Set(ctx, k, v1, 0)
+	cache.SetNamespaceSchema("drink", 2, func(oldVersion int, raw []byte) ([]byte, error) {
+		return nil, errors.New("unsupported")
+	})
+	assert.NotNil(t, cache.Get(ctx, "37", &drink, SkipLocal()))
+}
+
+// menu carries maps, which are the values whose JSON depends on the serializer ordering their keys
+type menu struct {
+	ID     string            `json:"id"`
+	Prices map[string]int    `json:"prices"`
+	Labels map[string]string `json:"labels"`
+}
+
+func (p *menu) Namespace() string {
+	return "menu"
+}
+
+func (p *menu) Key() string {
+	return p.ID
+}
+
+func TestLevelCache_DeterministicJSON(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	m := &menu{ID: "lunch", Prices: make(map[string]int), Labels: make(map[string]string)}
+	for i := 0; i < 50; i++ {
+		m.Prices[string(rune('a'+i%26))+string(rune('A'+i/26))] = i
+		m.Labels[string(rune('z'-i%26))+string(rune('Z'-i/26))] = toJson(i)
+	}
+	first, err := cache.marshal("menu", m)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		content, err := cache.marshal("menu", m)
+		assert.Nil(t, err)
+		if !assert.Equal(t, first, content) {
+			return
+		}
+		assert.Equal(t, first, toJson(m))
+	}
+
+	assert.Nil(t, cache.Set(context.TODO(), m))
+	local, remote, _, err := cache.Inspect(context.TODO(), "menu", "lunch")
+	assert.Nil(t, err)
+	assert.Equal(t, first, remote)
+	assert.Equal(t, local, remote)
+}
@@ -0,0 +1,147 @@
+package levelcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// loaderBuckets are the upper bounds of the loader latency histogram
+var loaderBuckets = [...]time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// Stats counts how the reads of the cache were served
+type Stats struct {
+	LocalHits uint64
+	RedisHits uint64
+	// Loads are the reads missing both levels and served by the loader
+	Loads     uint64
+	StaleHits uint64
+	Errors    uint64
+	// DroppedUpdates are the version updates not queued because MaxUpdateBuffer updates were pending
+	DroppedUpdates uint64
+	// DroppedEvents are the events not delivered because MaxEventBuffer events were waiting for the consumer
+	DroppedEvents uint64
+	// LocksAcquired and LockFailures count the reload locks taken and the attempts failing on a held lock,
+	// LockWait is the time spent waiting for them
+	LocksAcquired uint64
+	LockFailures  uint64
+	LockWait      time.Duration
+	// VersionCheckErrors are the versions of local hits which could not be read from redis
+	VersionCheckErrors uint64
+	// Seeds and Defaults are the reads missing both levels and served by the seed of GetOrSeed
+	// and by the WithDefault object
+	Seeds    uint64
+	Defaults uint64
+}
+
+// stats only holds uint64 counters, LevelCache allocates it on its own so that they are 64-bit aligned
+// for the atomic operations on 32-bit platforms
+type stats struct {
+	localHits    uint64
+	redisHits    uint64
+	loads        uint64
+	staleHits    uint64
+	errors       uint64
+	dropped      uint64
+	eventDrop    uint64
+	locks        uint64
+	lockFails    uint64
+	lockNanos    uint64
+	versionFails uint64
+	// loaderCounts counts the loader calls per loaderBuckets bound plus one for the longer ones
+	loaderCounts [len(loaderBuckets) + 1]uint64
+	loaderNanos  uint64
+	seeds        uint64
+	defaults     uint64
+}
+
+// latencyHistogram is a snapshot of the loader latencies, counts are not cumulative
+type latencyHistogram struct {
+	counts []uint64
+	sum    time.Duration
+}
+
+func (p *stats) record(src Source, err error) {
+	if err != nil {
+		atomic.AddUint64(&p.errors, 1)
+		return
+	}
+	switch src {
+	case SourceLocal:
+		atomic.AddUint64(&p.localHits, 1)
+	case SourceRedis:
+		atomic.AddUint64(&p.redisHits, 1)
+	case SourceLoader:
+		atomic.AddUint64(&p.loads, 1)
+	case SourceStale:
+		atomic.AddUint64(&p.staleHits, 1)
+	case SourceSeed:
+		atomic.AddUint64(&p.seeds, 1)
+	case SourceDefault:
+		atomic.AddUint64(&p.defaults, 1)
+	}
+}
+
+func (p *stats) dropUpdate() {
+	atomic.AddUint64(&p.dropped, 1)
+}
+
+func (p *stats) dropEvent() {
+	atomic.AddUint64(&p.eventDrop, 1)
+}
+
+func (p *stats) failVersionCheck() {
+	atomic.AddUint64(&p.versionFails, 1)
+}
+
+func (p *stats) failLock() {
+	atomic.AddUint64(&p.lockFails, 1)
+}
+
+func (p *stats) recordLock(wait time.Duration, acquired bool) {
+	if acquired {
+		atomic.AddUint64(&p.locks, 1)
+	}
+	atomic.AddUint64(&p.lockNanos, uint64(wait))
+}
+
+func (p *stats) recordLoader(d time.Duration) {
+	i := 0
+	for i < len(loaderBuckets) && d > loaderBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&p.loaderCounts[i], 1)
+	atomic.AddUint64(&p.loaderNanos, uint64(d))
+}
+
+func (p *stats) loaderLatency() latencyHistogram {
+	h := latencyHistogram{
+		counts: make([]uint64, len(p.loaderCounts)),
+		sum:    time.Duration(atomic.LoadUint64(&p.loaderNanos)),
+	}
+	for i := range p.loaderCounts {
+		h.counts[i] = atomic.LoadUint64(&p.loaderCounts[i])
+	}
+	return h
+}
+
+// Stats returns a snapshot of the read counters since the cache was created
+func (p *LevelCache) Stats() Stats {
+	return Stats{
+		LocalHits:          atomic.LoadUint64(&p.stats.localHits),
+		RedisHits:          atomic.LoadUint64(&p.stats.redisHits),
+		Loads:              atomic.LoadUint64(&p.stats.loads),
+		StaleHits:          atomic.LoadUint64(&p.stats.staleHits),
+		Errors:             atomic.LoadUint64(&p.stats.errors),
+		DroppedUpdates:     atomic.LoadUint64(&p.stats.dropped),
+		DroppedEvents:      atomic.LoadUint64(&p.stats.eventDrop),
+		LocksAcquired:      atomic.LoadUint64(&p.stats.locks),
+		LockFailures:       atomic.LoadUint64(&p.stats.lockFails),
+		LockWait:           time.Duration(atomic.LoadUint64(&p.stats.lockNanos)),
+		VersionCheckErrors: atomic.LoadUint64(&p.stats.versionFails),
+		Seeds:              atomic.LoadUint64(&p.stats.seeds),
+		Defaults:           atomic.LoadUint64(&p.stats.defaults),
+	}
+}
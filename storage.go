@@ -0,0 +1,173 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// SetHashStorage makes the namespace store its values in redis as the fields of a single hash named after it,
+// grouping many small objects under one key, instead of a string per value. Versions stay separate keys.
+// Fields cannot expire on their own: the hash expires as a whole once the longest lifetime written to it ran out,
+// and DeleteByPattern does not see its fields, clear them with ClearNamespace.
+// Values written before switching are not moved and are read again from the loader.
+func (p *LevelCache) SetHashStorage(namespace string, enabled bool) {
+	p.updateNamespaceConfig(namespace, func(cfg *namespaceConfig) {
+		cfg.hashStorage = enabled
+	})
+}
+
+func (p *LevelCache) hashStorage(namespace string) bool {
+	return p.namespaceConfig(namespace).hashStorage
+}
+
+// hashKeyPart is the first part of the keys of the hashes, see hashKey
+const hashKeyPart = "hash"
+
+// hashKey is the redis hash holding the values of a namespace with HashStorage
+func (p *LevelCache) hashKey(namespace string) string {
+	return p.cacheKey(hashKeyPart, namespace)
+}
+
+// storageKey returns the redis key holding the value of key in namespace and its field in that key,
+// the field is empty for values stored as strings
+func (p *LevelCache) storageKey(namespace, key string) (string, string) {
+	if p.hashStorage(namespace) {
+		return p.hashKey(namespace), key
+	}
+	return p.cacheKey(namespace, key), ""
+}
+
+// getEntry reads the raw value of key in namespace from c
+func (p *LevelCache) getEntry(ctx context.Context, c redis.Cmdable, namespace, key string) *redis.StringCmd {
+	k, field := p.storageKey(namespace, key)
+	if field != "" {
+		return c.HGet(ctx, k, field)
+	}
+	return c.Get(ctx, k)
+}
+
+// getOrSetScript returns {0, value, version} with the live value KEYS[1] and its version KEYS[2],
+// or writes ARGV[1] there when it has none and returns {1}. ARGV[2] is the expiration in milliseconds,
+// a non empty ARGV[3] the field of the hash KEYS[1] holding the value, whose expiration is only ever extended.
+// Tombstones, the envelopes with FlagTombstone set in their third byte, count as no value.
+var getOrSetScript = redis.NewScript(`
+local field = ARGV[3]
+local current
+if field == "" then
+	current = redis.call("GET", KEYS[1])
+else
+	current = redis.call("HGET", KEYS[1], field)
+end
+if current and not (string.byte(current, 1) == 255 and string.len(current) >= 3
+	and math.floor(string.byte(current, 3) / 2) % 2 == 1) then
+	return {0, current, tonumber(redis.call("GET", KEYS[2]) or "0")}
+end
+local ttl = tonumber(ARGV[2])
+if field ~= "" then
+	local pttl = redis.call("PTTL", KEYS[1])
+	redis.call("HSET", KEYS[1], field, ARGV[1])
+	if ttl <= 0 then
+		redis.call("PERSIST", KEYS[1])
+	elseif pttl == -2 or (pttl >= 0 and pttl < ttl) then
+		redis.call("PEXPIRE", KEYS[1], ttl)
+	end
+elseif ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return {1}
+`)
+
+// getOrSetEntry writes the raw value of key in namespace unless redis already holds a live value, atomically,
+// and returns the value redis holds afterwards along with the version of a value found there.
+// Filling a missing value is no write of the key, like setEntry it leaves the version alone.
+// A missing string value is written by SET NX alone, getOrSetScript handles hash fields and the string values
+// which are already there, tombstones included.
+func (p *LevelCache) getOrSetEntry(ctx context.Context, namespace, key, content string, ttl time.Duration) (string, int64, error) {
+	k, field := p.storageKey(namespace, key)
+	if field == "" {
+		set, err := p.rdb.SetNX(ctx, k, content, redisTTL(ttl)).Result()
+		if err != nil || set {
+			return content, 0, err
+		}
+	}
+	res, err := getOrSetScript.Run(ctx, p.rdb, []string{k, p.versionKey(namespace, key)},
+		content, ttl.Milliseconds(), field).Result()
+	if err != nil {
+		return "", 0, err
+	}
+	reply, _ := res.([]interface{})
+	if len(reply) == 1 {
+		return content, 0, nil
+	}
+	if len(reply) != 3 {
+		return "", 0, fmt.Errorf("get or set [%s] key [%s]: unexpected reply %v", namespace, key, res)
+	}
+	current, _ := reply[1].(string)
+	version, _ := reply[2].(int64)
+	return current, version, nil
+}
+
+// setEntry writes the raw value of key in namespace to c without touching its version
+func (p *LevelCache) setEntry(ctx context.Context, c redis.Cmdable, namespace, key, content string, ttl time.Duration) error {
+	k, field := p.storageKey(namespace, key)
+	if field == "" {
+		return c.Set(ctx, k, content, redisTTL(ttl)).Err()
+	}
+	return setScript.Run(ctx, c, []string{k, p.versionKey(namespace, key), p.historyKey(namespace, key)},
+		content, ttl.Milliseconds(), anyVersion, 0, false, versionGrace.Milliseconds(), field).Err()
+}
+
+// ClearNamespace removes the hash of a namespace with HashStorage along with the versions of its values,
+// evicting their local entries. It returns ErrHashStorageDisabled for other namespaces, see DeleteByPattern.
+func (p *LevelCache) ClearNamespace(ctx context.Context, namespace string) error {
+	return p.clearNamespace(ctx, namespace, func(namespace, key string) {
+		p.invalidated(EventDelete, namespace, key)
+	})
+}
+
+// clearNamespace is ClearNamespace reporting each removed value to deleted instead of invalidating it
+func (p *LevelCache) clearNamespace(ctx context.Context, namespace string, deleted func(namespace, key string)) error {
+	if p.localOnly() {
+		return ErrRedisDisabled
+	}
+	if !p.hashStorage(namespace) {
+		return fmt.Errorf("clear [%s]: %w", namespace, ErrHashStorageDisabled)
+	}
+	k := p.hashKey(namespace)
+	var keys []string
+	iter := p.rdb.HScan(ctx, k, 0, "", deleteBatch).Iterator()
+	for i := 0; iter.Next(ctx); i++ {
+		// fields and values alternate
+		if i%2 == 0 {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if err := p.rdb.Del(ctx, k).Err(); err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += deleteBatch {
+		batch := keys[start:]
+		if len(batch) > deleteBatch {
+			batch = batch[:deleteBatch]
+		}
+		versionKeys := make([]string, len(batch))
+		for i, key := range batch {
+			versionKeys[i] = p.versionKey(namespace, key)
+		}
+		if err := p.rdb.Del(ctx, versionKeys...).Err(); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		p.c.Delete(p.cacheKey(namespace, key))
+		deleted(namespace, key)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLevelCache_HashStorage(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache.SetHashStorage("dish", true)
+	assert.Nil(t, cache.ClearNamespace(context.TODO(), "dish"))
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "65"), cache.cacheKey("dish", "66"), cache.cacheKey("dish", "67"))
+
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 65, Name: "a"}))
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 66, Name: "b"}))
+	assert.Nil(t, cache.MSet(context.TODO(), []Cacheable{&Dish{ID: 67, Name: "c"}}))
+	fields, err := cache.rdb.HKeys(context.TODO(), cache.hashKey("dish")).Result()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"65", "66", "67"}, fields)
+	assert.Equal(t, int64(0), cache.rdb.Exists(context.TODO(), cache.cacheKey("dish", "65")).Val())
+
+	cache.FlushLocal()
+	for id, name := range map[string]string{"65": "a", "66": "b", "67": "c"} {
+		var dish Dish
+		src, err := cache.GetWithSource(context.TODO(), id, &dish)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceRedis, src)
+		assert.Equal(t, name, dish.Name)
+	}
+
+	_, _, version, err := cache.Inspect(context.TODO(), "dish", "66")
+	assert.Nil(t, err)
+	deleted, err := cache.DeleteIfVersion(context.TODO(), "dish", "66", version)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	assert.False(t, cache.rdb.HExists(context.TODO(), cache.hashKey("dish"), "66").Val())
+
+	assert.Nil(t, cache.ClearNamespace(context.TODO(), "dish"))
+	assert.Equal(t, int64(0), cache.rdb.Exists(context.TODO(), cache.hashKey("dish"), cache.versionKey("dish", "65")).Val())
+	var dish Dish
+	assert.NotNil(t, cache.Get(context.TODO(), "65", &dish))
+
+	cache.SetHashStorage("dish", false)
+	assert.True(t, errors.Is(cache.ClearNamespace(context.TODO(), "dish"), ErrHashStorageDisabled))
+}
+
+func TestLevelCache_ColdLoadRace(t *testing.T) {
+	var (
+		caches  [2]*LevelCache
+		loading sync.WaitGroup
+	)
+	loading.Add(len(caches))
+	for i := range caches {
+		cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		name := "loader-" + strconv.Itoa(i)
+		_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+			// both instances missed redis before either writes back
+			loading.Done()
+			loading.Wait()
+			return &Dish{ID: 89, Name: name}, nil
+		})
+		caches[i] = cache
+	}
+	caches[0].rdb.Del(context.TODO(), caches[0].cacheKey("dish", "89"))
+
+	var (
+		wg     sync.WaitGroup
+		dishes [2]Dish
+	)
+	for i := range caches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, caches[i].Get(context.TODO(), "89", &dishes[i]))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, dishes[0], dishes[1])
+	var stored Dish
+	assert.Nil(t, caches[0].Get(context.TODO(), "89", &stored, SkipLocal()))
+	assert.Equal(t, dishes[0], stored)
+	for _, cache := range caches {
+		var local Dish
+		found, err := cache.GetLocal("89", &local)
+		assert.Nil(t, err)
+		assert.True(t, found)
+		assert.Equal(t, dishes[0], local)
+	}
+}
+
+func TestLevelCache_ColdLoadSetRace(t *testing.T) {
+	var (
+		caches  [2]*LevelCache
+		loading sync.WaitGroup
+		written = make(chan struct{})
+	)
+	loading.Add(len(caches))
+	for i := range caches {
+		cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+		if err != nil {
+			t.Errorf("init cache fail:%+v", err)
+			return
+		}
+		_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+			// the loaders read the source before the write and write back after it
+			loading.Done()
+			<-written
+			return &Dish{ID: 91, Name: "loaded"}, nil
+		})
+		caches[i] = cache
+	}
+	ctx := context.TODO()
+	caches[0].rdb.Del(ctx, caches[0].cacheKey("dish", "91"), caches[0].versionKey("dish", "91"))
+
+	var (
+		wg     sync.WaitGroup
+		dishes [2]Dish
+	)
+	for i := range caches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, caches[i].Get(ctx, "91", &dishes[i]))
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(written)
+		loading.Wait()
+		assert.Nil(t, caches[1].Set(ctx, &Dish{ID: 91, Name: "written"}))
+	}()
+	wg.Wait()
+
+	// the value written meanwhile is never overwritten by the older loads
+	for i := range caches {
+		assert.Equal(t, "written", dishes[i].Name)
+	}
+	var stored Dish
+	assert.Nil(t, caches[0].Get(ctx, "91", &stored, SkipLocal()))
+	assert.Equal(t, "written", stored.Name)
+	version, err := caches[0].rdb.Get(ctx, caches[0].versionKey("dish", "91")).Int64()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), version)
+}
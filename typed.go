@@ -0,0 +1,14 @@
+package levelcache
+
+import "context"
+
+// GetTyped is Get for callers that would rather receive a typed value than fill a pre-allocated one,
+// newT creates the empty value to fill, typically a pointer to a new struct.
+func GetTyped[T Cacheable](ctx context.Context, c Cache, key string, newT func() T, opts ...GetOption) (T, error) {
+	obj := newT()
+	if err := c.Get(ctx, key, obj, opts...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,33 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetTyped(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", GetDish)
+	newDish := func() *Dish { return &Dish{} }
+
+	dish, err := GetTyped[*Dish](context.TODO(), cache, "1", newDish)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, dish.ID)
+
+	dish, err = GetTyped(context.TODO(), cache, "2", newDish, SkipLocal())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dish.ID)
+
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "missing"))
+	dish, err = GetTyped(context.TODO(), cache, "missing", newDish)
+	assert.NotNil(t, err)
+	assert.Nil(t, dish)
+}
@@ -0,0 +1,37 @@
+package levelcache
+
+// SetUpdateBuffer replaces the buffer of pending version updates by one holding n of them without recreating
+// the cache, e.g. when Stats reports DroppedUpdates during invalidation bursts. The pending updates move to the
+// new buffer, those beyond n are dropped and counted like updates finding the buffer full.
+// A size below one restores MaxUpdateBuffer.
+func (p *LevelCache) SetUpdateBuffer(n int) {
+	if n < 1 {
+		n = p.cfg.MaxUpdateBuffer
+	}
+	p.umu.Lock()
+	defer p.umu.Unlock()
+	old := p.updates
+	p.updates = make(chan versionInfo, n)
+drain:
+	for {
+		select {
+		case update := <-old:
+			select {
+			case p.updates <- update:
+			default:
+				p.stats.dropUpdate()
+			}
+		default:
+			break drain
+		}
+	}
+	// nothing sends to the old buffer anymore, closing it wakes the worker waiting on it
+	close(old)
+}
+
+// updateBuffer returns the current buffer of pending version updates
+func (p *LevelCache) updateBuffer() chan versionInfo {
+	p.umu.RLock()
+	defer p.umu.RUnlock()
+	return p.updates
+}
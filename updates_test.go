@@ -0,0 +1,68 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_SetUpdateBuffer(t *testing.T) {
+	// the initial buffer must hold all the updates as well, the sender may run before the first resize
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10, MaxUpdateBuffer: 200})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("resize-%d", i)
+		k := cache.cacheKey("dish", keys[i])
+		cache.rdb.Set(context.TODO(), k, toJson(&Dish{ID: i}), 0)
+		cache.setVersion(k, 0)
+	}
+	cache.Start(context.Background())
+	defer cache.Stop()
+
+	// never smaller than the updates sent, so that none is dropped
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for _, key := range keys {
+			cache.applyVersion("dish", key, "1")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			cache.SetUpdateBuffer(len(keys) + i%3*100)
+		}
+	}()
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		for _, key := range keys {
+			if v, _ := cache.getVersion(cache.cacheKey("dish", key)); v != 1 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(0), cache.Stats().DroppedUpdates)
+
+	// shrinking below the pending updates drops the excess
+	idle, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	for _, key := range keys[:3] {
+		idle.setVersion(idle.cacheKey("dish", key), 0)
+		idle.applyVersion("dish", key, "1")
+	}
+	idle.SetUpdateBuffer(1)
+	assert.Len(t, idle.updates, 1)
+	assert.Equal(t, uint64(2), idle.Stats().DroppedUpdates)
+}
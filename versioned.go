@@ -0,0 +1,88 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+)
+
+// getVersionedScript reads a value, from the hash field ARGV[1] when not empty, along with its version
+var getVersionedScript = redis.NewScript(`
+local value
+if ARGV[1] == "" then
+	value = redis.call("GET", KEYS[1])
+else
+	value = redis.call("HGET", KEYS[1], ARGV[1])
+end
+return {value, redis.call("GET", KEYS[2])}
+`)
+
+// GetVersioned fills obj like Get and returns the version of the value filled, to pass to SetIfVersion
+// or DeleteIfVersion later on. Value and version are read from redis together, never from the local cache,
+// so that they always match; a value missing from redis is loaded first. Zero stands for a value never written
+// by Set, which SetIfVersion accepts as such.
+func (p *LevelCache) GetVersioned(ctx context.Context, key string, obj Cacheable) (int64, error) {
+	if err := checkObject(obj, true); err != nil {
+		return 0, err
+	}
+	namespace := obj.Namespace()
+	if p.localOnly() {
+		return 0, ErrRedisDisabled
+	}
+	if p.versioningDisabled(namespace) {
+		return 0, ErrVersioningDisabled
+	}
+	if err := p.checkType(namespace, obj); err != nil {
+		return 0, err
+	}
+	content, version, err := p.getVersioned(ctx, namespace, key)
+	if err != nil {
+		return 0, err
+	}
+	if content == "" {
+		if _, err := p.get(ctx, key, obj, getOptions{skipLocal: true}); err != nil {
+			return 0, err
+		}
+		// read back what the loader wrote, unless redis did not take it
+		if content, version, err = p.getVersioned(ctx, namespace, key); err != nil || content == "" {
+			version, err = p.currentVersion(ctx, namespace, key)
+			return version, err
+		}
+	} else {
+		p.stats.record(SourceRedis, nil)
+	}
+	if err := p.unmarshal(namespace, content, obj); err != nil {
+		return 0, err
+	}
+	p.setLocal(namespace, key, content, 0)
+	if !p.namespaceConfig(namespace).localDisabled {
+		p.raiseVersion(p.cacheKey(namespace, key), version)
+	}
+	return version, nil
+}
+
+// getVersioned reads the live value of key along with its version, the value is empty when missing
+func (p *LevelCache) getVersioned(ctx context.Context, namespace, key string) (string, int64, error) {
+	k, field := p.storageKey(namespace, key)
+	res, err := getVersionedScript.Run(ctx, p.rdb, []string{k, p.versionKey(namespace, key)}, field).Result()
+	if err != nil {
+		return "", 0, fmt.Errorf("get versioned [%s] key [%s]: %w", namespace, key, err)
+	}
+	reply, _ := res.([]interface{})
+	if len(reply) == 0 {
+		return "", 0, nil
+	}
+	var version int64
+	if len(reply) > 1 {
+		if v, ok := reply[1].(string); ok {
+			version, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+	content, _ := reply[0].(string)
+	if content, err = liveEntry(content); err != nil {
+		// a tombstone
+		return "", version, nil
+	}
+	return content, version, nil
+}
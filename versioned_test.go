@@ -0,0 +1,52 @@
+package levelcache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevelCache_GetVersioned(t *testing.T) {
+	cache, err := New(CacheConfig{RedisAddr: "localhost:6379", RedisPoolSize: 10})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 82}, nil
+	})
+	ctx := context.TODO()
+	cache.rdb.Del(ctx, cache.cacheKey("dish", "82"), cache.versionKey("dish", "82"))
+
+	// a loaded value was never written by Set
+	var dish Dish
+	version, err := cache.GetVersioned(ctx, "82", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), version)
+	assert.Equal(t, 82, dish.ID)
+
+	dish.Name = "v1"
+	ok, err := cache.SetIfVersion(ctx, &dish, version)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	version, err = cache.GetVersioned(ctx, "82", &dish)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, "v1", dish.Name)
+	dish.Name = "v2"
+	ok, err = cache.SetIfVersion(ctx, &dish, version)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// the version read is stale once another writer moved past it
+	dish.Name = "v3"
+	ok, err = cache.SetIfVersion(ctx, &dish, version)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	var current Dish
+	version, err = cache.GetVersioned(ctx, "82", &current)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, "v2", current.Name)
+}
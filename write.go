@@ -0,0 +1,349 @@
+package levelcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// anyVersion makes setScript write whatever the current version is
+const anyVersion = -1
+
+// versionGrace is how much longer than its value a version key lives,
+// so that the version outlives the value it counts and never reads as zero while the value is still there
+const versionGrace = time.Minute
+
+// setScript writes the value KEYS[1] and increments its version KEYS[2] atomically,
+// ARGV[2] is the expiration in milliseconds and ARGV[3] the expected version or anyVersion.
+// When ARGV[4] is positive the replaced value is pushed to the history list KEYS[3] trimmed to ARGV[4] entries,
+// the version is left untouched when ARGV[5] is 0, otherwise it expires ARGV[6] milliseconds after the value
+// or never when the value does not expire.
+// A non empty ARGV[7] stores the value as that field of the hash KEYS[1], whose expiration is only ever extended.
+// It returns the new version, or 0 when the current version is not the expected one or not incremented.
+var setScript = redis.NewScript(`
+local expected = tonumber(ARGV[3])
+if expected >= 0 and tonumber(redis.call("GET", KEYS[2]) or "0") ~= expected then
+	return 0
+end
+local field = ARGV[7]
+local depth = tonumber(ARGV[4])
+if depth > 0 then
+	local previous
+	if field == "" then
+		previous = redis.call("GET", KEYS[1])
+	else
+		previous = redis.call("HGET", KEYS[1], field)
+	end
+	if previous then
+		redis.call("LPUSH", KEYS[3], previous)
+		redis.call("LTRIM", KEYS[3], 0, depth - 1)
+	end
+end
+if field ~= "" then
+	local pttl = redis.call("PTTL", KEYS[1])
+	redis.call("HSET", KEYS[1], field, ARGV[1])
+	if tonumber(ARGV[2]) <= 0 then
+		redis.call("PERSIST", KEYS[1])
+	elseif pttl == -2 or (pttl >= 0 and pttl < tonumber(ARGV[2])) then
+		redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+elseif tonumber(ARGV[2]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+if ARGV[5] == "0" then
+	return 0
+end
+local version = redis.call("INCR", KEYS[2])
+if tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[2], tonumber(ARGV[2]) + tonumber(ARGV[6]))
+else
+	redis.call("PERSIST", KEYS[2])
+end
+return version
+`)
+
+// touchScript sets the expiration of KEYS[1] to ARGV[1] milliseconds, removing it when not positive,
+// and aligns the expiration of its version KEYS[2] ARGV[2] milliseconds later like setScript.
+// A non empty ARGV[3] is the field of the hash KEYS[1] holding the value, the hash expiration is only ever extended.
+// It returns 0 when the key does not exist.
+var touchScript = redis.NewScript(`
+local field = ARGV[3]
+if field == "" then
+	if redis.call("EXISTS", KEYS[1]) == 0 then
+		return 0
+	end
+elseif redis.call("HEXISTS", KEYS[1], field) == 0 then
+	return 0
+end
+if tonumber(ARGV[1]) > 0 then
+	if field == "" then
+		redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	else
+		local pttl = redis.call("PTTL", KEYS[1])
+		if pttl >= 0 and pttl < tonumber(ARGV[1]) then
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+	end
+	redis.call("PEXPIRE", KEYS[2], tonumber(ARGV[1]) + tonumber(ARGV[2]))
+else
+	redis.call("PERSIST", KEYS[1])
+	redis.call("PERSIST", KEYS[2])
+end
+return 1
+`)
+
+type writeTask struct {
+	namespace string
+	key       string
+	content   string
+}
+
+// Set writes obj to both cache levels and bumps its version, see WriteCoalesceWindow to delay the redis write.
+// It returns ErrValueTooLarge without writing when obj exceeds MaxValueBytes,
+// and ErrClosed for a write to coalesce once the cache is closed.
+func (p *LevelCache) Set(ctx context.Context, obj Cacheable) error {
+	if err := checkObject(obj, false); err != nil {
+		return err
+	}
+	key := ObjectKey(obj)
+	content, err := p.marshal(obj.Namespace(), obj)
+	if err != nil {
+		return err
+	}
+	if err := p.checkSize(obj.Namespace(), key, content); err != nil {
+		return err
+	}
+	p.setLocal(obj.Namespace(), key, content, 0)
+	if p.cfg.WriteCoalesceWindow > 0 && !p.localOnly() {
+		if err := p.coalesce(writeTask{namespace: obj.Namespace(), key: key, content: content}); err != nil {
+			return err
+		}
+		p.emit(EventSet, obj.Namespace(), key)
+		return nil
+	}
+	if err := p.setRedis(ctx, obj.Namespace(), key, content, 0); err != nil {
+		return err
+	}
+	p.emit(EventSet, obj.Namespace(), key)
+	return nil
+}
+
+// MSet writes objs like Set with a single redis pipeline per namespace instead of a round trip per object.
+// Objects which cannot be serialized or exceed MaxValueBytes are skipped, the others are still written.
+// Failures are returned as a MultiError keyed by "[namespace] key" of each object,
+// or by "#i" for the invalid object at index i.
+func (p *LevelCache) MSet(ctx context.Context, objs []Cacheable) error {
+	var (
+		namespaces []string
+		failed     = make(map[string]error)
+		writes     = make(map[string][]refreshWrite)
+	)
+	for i, obj := range objs {
+		if err := checkObject(obj, false); err != nil {
+			failed[fmt.Sprintf("#%d", i)] = err
+			continue
+		}
+		namespace, key := obj.Namespace(), ObjectKey(obj)
+		content, err := p.marshal(namespace, obj)
+		if err == nil {
+			err = p.checkSize(namespace, key, content)
+		}
+		if err != nil {
+			failed[fmt.Sprintf("[%s] %s", namespace, key)] = err
+			continue
+		}
+		p.setLocal(namespace, key, content, 0)
+		if _, ok := writes[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+		writes[namespace] = append(writes[namespace], refreshWrite{key: key, content: content})
+	}
+	for _, namespace := range namespaces {
+		errs := p.setRedisMany(ctx, namespace, writes[namespace])
+		for key, err := range errs {
+			failed[fmt.Sprintf("[%s] %s", namespace, key)] = err
+		}
+		for _, w := range writes[namespace] {
+			if _, ok := errs[w.key]; !ok {
+				p.emit(EventSet, namespace, w.key)
+			}
+		}
+	}
+	return multiError("mset", failed)
+}
+
+// SetIfVersion writes obj like Set only when its current version equals expectedVersion,
+// zero standing for a key never written. It reports whether the write happened.
+func (p *LevelCache) SetIfVersion(ctx context.Context, obj Cacheable, expectedVersion int64) (bool, error) {
+	if err := checkObject(obj, false); err != nil {
+		return false, err
+	}
+	key := ObjectKey(obj)
+	content, err := p.marshal(obj.Namespace(), obj)
+	if err != nil {
+		return false, err
+	}
+	if err := p.checkSize(obj.Namespace(), key, content); err != nil {
+		return false, err
+	}
+	recNo, err := p.setRedisIfVersion(ctx, obj.Namespace(), key, content, expectedVersion, p.cfg.RedisExpiration)
+	if err != nil || recNo == 0 {
+		return false, err
+	}
+	p.setLocal(obj.Namespace(), key, content, 0)
+	p.emit(EventSet, obj.Namespace(), key)
+	return true, nil
+}
+
+// SetAsync writes obj to the local cache right away and leaves the redis write to the Start worker.
+// Nil objects and values exceeding MaxValueBytes are logged and dropped.
+// When the worker is not running or MaxWriteBuffer writes are already pending
+// the redis write happens synchronously instead, so no write is ever dropped.
+// Pending writes are flushed by Stop.
+func (p *LevelCache) SetAsync(ctx context.Context, obj Cacheable) {
+	if err := checkObject(obj, false); err != nil {
+		p.cfg.Logger.Printf("async write fail: %v", err)
+		return
+	}
+	content, err := p.marshal(obj.Namespace(), obj)
+	if err != nil {
+		p.cfg.Logger.Printf("async write fail: %v", err)
+		return
+	}
+	w := writeTask{
+		namespace: obj.Namespace(),
+		key:       ObjectKey(obj),
+		content:   content,
+	}
+	if p.checkSize(w.namespace, w.key, w.content) != nil {
+		return
+	}
+	p.setLocal(w.namespace, w.key, w.content, 0)
+	p.emit(EventSet, w.namespace, w.key)
+
+	p.wmu.RLock()
+	if p.started {
+		select {
+		case p.writes <- w:
+			p.wmu.RUnlock()
+			return
+		default:
+		}
+	}
+	p.wmu.RUnlock()
+	p.write(ctx, w)
+}
+
+func (p *LevelCache) write(ctx context.Context, w writeTask) {
+	ctx, cancel := p.backgroundContext(ctx)
+	defer cancel()
+	if err := p.setRedis(ctx, w.namespace, w.key, w.content, 0); err != nil {
+		p.cfg.Logger.Printf("async write [%s] key [%s] fail: %v", w.namespace, w.key, err)
+	}
+}
+
+// flushWrites stops accepting async writes and writes the pending ones
+func (p *LevelCache) flushWrites(ctx context.Context) {
+	p.wmu.Lock()
+	p.started = false
+	p.wmu.Unlock()
+	for {
+		select {
+		case w := <-p.writes:
+			p.runTask("async write", func() {
+				p.write(ctx, w)
+			})
+		default:
+			return
+		}
+	}
+}
+
+// Touch extends the lifetime of key to ttl on both levels without reloading it, a zero ttl stands for
+// LocalExpiration and RedisExpiration and NoExpiration makes the value never expire. It returns ErrNotFound when redis misses the key,
+// or the local cache when created by NewLocalOnly. The version key keeps outliving the value.
+func (p *LevelCache) Touch(ctx context.Context, namespace, key string, ttl time.Duration) error {
+	k := p.cacheKey(namespace, key)
+	cached, ok := p.c.Get(k)
+	if !p.localOnly() {
+		sk, field := p.storageKey(namespace, key)
+		touched, err := touchScript.Run(ctx, p.rdb, []string{sk, p.versionKey(namespace, key)},
+			p.redisExpiration(ttl).Milliseconds(), versionGrace.Milliseconds(), field).Int()
+		if err != nil {
+			return err
+		}
+		ok = touched == 1
+	}
+	if !ok {
+		return fmt.Errorf("touch [%s] key [%s]: %w", namespace, key, ErrNotFound)
+	}
+	if cached != nil {
+		p.c.Set(k, cached, p.localExpiration(ttl))
+	}
+	return nil
+}
+
+// setRedisMany writes the values reloaded by RefreshMany like setRedis in a single pipeline,
+// records their new versions at once and releases their locks. It returns the failures by key.
+func (p *LevelCache) setRedisMany(ctx context.Context, namespace string, writes []refreshWrite) map[string]error {
+	defer func() {
+		for _, w := range writes {
+			w.release(ctx)
+		}
+	}()
+	if p.localOnly() || p.oversized(namespace) || len(writes) == 0 {
+		return nil
+	}
+	versioned := !p.versioningDisabled(namespace)
+	cmds := make([]redis.Cmder, len(writes))
+	_, _ = p.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		scripted := versioned || p.cfg.HistoryDepth > 0 || p.hashStorage(namespace)
+		if scripted {
+			// loaded ahead in the same pipeline so that EVALSHA never misses the script
+			setScript.Load(ctx, pipe)
+		}
+		for i, w := range writes {
+			k, field := p.storageKey(namespace, w.key)
+			ttl := p.redisExpiration(w.ttl)
+			if scripted {
+				cmds[i] = setScript.EvalSha(ctx, pipe, []string{k, p.versionKey(namespace, w.key), p.historyKey(namespace, w.key)},
+					w.content, ttl.Milliseconds(), anyVersion, p.cfg.HistoryDepth, versioned, versionGrace.Milliseconds(), field)
+			} else {
+				cmds[i] = pipe.Set(ctx, k, w.content, redisTTL(ttl))
+			}
+			if p.cfg.ServeStaleOnError {
+				pipe.Set(ctx, p.cacheKey("stale", namespace, w.key), w.content, p.cfg.StaleExpiration)
+			}
+		}
+		return nil
+	})
+
+	errs := make(map[string]error)
+	track := versioned && !p.namespaceConfig(namespace).localDisabled
+	p.vmu.Lock()
+	defer p.vmu.Unlock()
+	for i, w := range writes {
+		if err := cmds[i].Err(); err != nil {
+			errs[w.key] = err
+			continue
+		}
+		cmd, ok := cmds[i].(*redis.Cmd)
+		if !ok || !track {
+			continue
+		}
+		v, err := cmd.Int64()
+		if err != nil {
+			errs[w.key] = err
+			continue
+		}
+		k := p.cacheKey(namespace, w.key)
+		if current, ok := p.version[k]; !ok || current < v {
+			p.version[k] = v
+		}
+	}
+	return errs
+}
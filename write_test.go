@@ -0,0 +1,424 @@
+package levelcache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLevelCache_Set(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	k := cache.cacheKey("dish", "5")
+	before, _ := cache.rdb.Get(context.TODO(), cache.versionKey("dish", "5")).Int64()
+
+	dish := &Dish{ID: 5, Name: "YuXiangRouSi"}
+	assert.Nil(t, cache.Set(context.TODO(), dish))
+	content, err := cache.rdb.Get(context.TODO(), k).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, toJson(dish), content)
+	after, _ := cache.rdb.Get(context.TODO(), cache.versionKey("dish", "5")).Int64()
+	assert.Equal(t, before+1, after)
+
+	var got Dish
+	assert.Nil(t, cache.Get(context.TODO(), "5", &got))
+	assert.Equal(t, *dish, got)
+}
+
+func TestLevelCache_SetAsync(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache.Start(context.Background())
+	k := cache.cacheKey("dish", "6")
+	cache.rdb.Del(context.TODO(), k)
+
+	dish := &Dish{ID: 6, Name: "HongShaoRou"}
+	cache.SetAsync(context.TODO(), dish)
+	local, ok := cache.c.Get(k)
+	assert.True(t, ok)
+	assert.Equal(t, toJson(dish), local)
+
+	deadline := time.Now().Add(time.Second)
+	content := ""
+	for content == "" && time.Now().Before(deadline) {
+		content, _ = cache.rdb.Get(context.TODO(), k).Result()
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, toJson(dish), content)
+
+	// pending writes are flushed by Stop
+	for i := 0; i < 50; i++ {
+		cache.SetAsync(context.TODO(), &Dish{ID: 6, Name: "HongShaoRou", Taste: i})
+	}
+	cache.Stop()
+	content, _ = cache.rdb.Get(context.TODO(), k).Result()
+	assert.Equal(t, toJson(&Dish{ID: 6, Name: "HongShaoRou", Taste: 49}), content)
+}
+
+func TestLevelCache_SetAtomic(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	before, _ := cache.currentVersion(context.TODO(), "dish", "9")
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		versions []int64
+		written  = make(map[int64]string)
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				content := toJson(&Dish{ID: 9, Taste: i*10 + j})
+				v, err := cache.setRedisIfVersion(context.TODO(), "dish", "9", content, anyVersion, cache.cfg.CacheExpiration)
+				assert.Nil(t, err)
+				mu.Lock()
+				versions = append(versions, v)
+				written[v] = content
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for i, v := range versions {
+		assert.Equal(t, before+int64(i)+1, v)
+	}
+	last := versions[len(versions)-1]
+	_, remote, current, err := cache.Inspect(context.TODO(), "dish", "9")
+	assert.Nil(t, err)
+	assert.Equal(t, last, current)
+	assert.Equal(t, written[last], remote)
+	local, _ := cache.getVersion(cache.cacheKey("dish", "9"))
+	assert.Equal(t, last, local)
+}
+
+func TestLevelCache_SetIfVersion(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 10, Name: "v1"}))
+	version, _ := cache.currentVersion(context.TODO(), "dish", "10")
+
+	ok, err := cache.SetIfVersion(context.TODO(), &Dish{ID: 10, Name: "v2"}, version)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = cache.SetIfVersion(context.TODO(), &Dish{ID: 10, Name: "v3"}, version)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "10", &dish))
+	assert.Equal(t, "v2", dish.Name)
+}
+
+func TestLevelCache_MaxValueBytes(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxValueBytes: 1024,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	huge := &Dish{ID: 9, Comment: strings.Repeat("x", 2048)}
+	k := cache.cacheKey("dish", "9")
+	cache.rdb.Del(context.TODO(), k)
+
+	err = cache.Set(context.TODO(), huge)
+	assert.True(t, errors.Is(err, ErrValueTooLarge))
+	assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), k).Err())
+	_, ok := cache.c.Get(k)
+	assert.False(t, ok)
+
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return huge, nil
+	})
+	var dish Dish
+	assert.Nil(t, cache.Get(context.TODO(), "9", &dish))
+	assert.Equal(t, *huge, dish)
+	assert.Equal(t, redis.Nil, cache.rdb.Get(context.TODO(), k).Err())
+	_, ok = cache.c.Get(k)
+	assert.False(t, ok)
+}
+
+func TestLevelCache_History(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		HistoryDepth:  3,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	cache.rdb.Del(context.TODO(), cache.cacheKey("dish", "17"), cache.historyKey("dish", "17"))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, cache.Set(context.TODO(), &Dish{ID: 17, Price: float64(i)}))
+	}
+
+	history, err := cache.History(context.TODO(), "dish", "17", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		toJson(&Dish{ID: 17, Price: 3}),
+		toJson(&Dish{ID: 17, Price: 2}),
+		toJson(&Dish{ID: 17, Price: 1}),
+	}, history)
+
+	history, err = cache.History(context.TODO(), "dish", "17", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{toJson(&Dish{ID: 17, Price: 3}), toJson(&Dish{ID: 17, Price: 2})}, history)
+
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 17, Price: 5}, nil
+	})
+	assert.Nil(t, cache.refresh(context.TODO(), "dish", "17", func() (Cacheable, time.Duration, error) {
+		return cache.load(context.TODO(), "dish", "17", cache.loaders["dish"])
+	}))
+	history, err = cache.History(context.TODO(), "dish", "17", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{toJson(&Dish{ID: 17, Price: 4})}, history)
+}
+
+func TestLevelCache_Touch(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	k := cache.cacheKey("dish", "41")
+	cache.rdb.Del(ctx, k)
+	cache.c.Delete(k)
+	assert.True(t, errors.Is(cache.Touch(ctx, "dish", "41", time.Hour), ErrNotFound))
+
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		return &Dish{ID: 41, Name: "touched"}, nil
+	})
+	var dish Dish
+	assert.Nil(t, cache.Get(ctx, "41", &dish, WithTTL(time.Minute)))
+	ttl, _ := cache.rdb.PTTL(ctx, k).Result()
+	assert.InDelta(t, float64(time.Minute), float64(ttl), float64(time.Second))
+
+	assert.Nil(t, cache.Touch(ctx, "dish", "41", time.Hour))
+	ttl, _ = cache.rdb.PTTL(ctx, k).Result()
+	assert.InDelta(t, float64(time.Hour), float64(ttl), float64(time.Second))
+	_, expiration, ok := cache.c.GetWithExpiration(k)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(time.Until(expiration)), float64(time.Second))
+
+	assert.Nil(t, cache.Touch(ctx, "dish", "41", NoExpiration))
+	ttl, _ = cache.rdb.PTTL(ctx, k).Result()
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestLevelCache_VersionExpiration(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		CacheExpiration: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	_ = cache.RegisterLoader("dish", GetDish)
+	vk := cache.versionKey("dish", "48")
+	cache.rdb.Persist(ctx, vk)
+
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 48}))
+	ttl, _ := cache.rdb.PTTL(ctx, vk).Result()
+	assert.InDelta(t, float64(10*time.Minute+versionGrace), float64(ttl), float64(time.Second))
+	assert.Nil(t, cache.RefreshMany(ctx, "dish", []string{"1"}))
+	ttl, _ = cache.rdb.PTTL(ctx, cache.versionKey("dish", "1")).Result()
+	assert.InDelta(t, float64(10*time.Minute+versionGrace), float64(ttl), float64(time.Second))
+
+	assert.Nil(t, cache.Touch(ctx, "dish", "48", time.Hour))
+	ttl, _ = cache.rdb.PTTL(ctx, vk).Result()
+	assert.InDelta(t, float64(time.Hour+versionGrace), float64(ttl), float64(time.Second))
+
+	// versions of values which never expire never expire either
+	assert.Nil(t, cache.Touch(ctx, "dish", "48", NoExpiration))
+	ttl, _ = cache.rdb.PTTL(ctx, vk).Result()
+	assert.Equal(t, NoExpiration, ttl)
+	assert.Nil(t, cache.rdb.PExpire(ctx, vk, time.Minute).Err())
+	persistent, err := New(CacheConfig{
+		RedisAddr:       "localhost:6379",
+		RedisPoolSize:   10,
+		CacheExpiration: NoExpiration,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	assert.Nil(t, persistent.Set(ctx, &Dish{ID: 48}))
+	ttl, _ = cache.rdb.PTTL(ctx, vk).Result()
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestLevelCache_WriteCoalesceWindow(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:           "localhost:6379",
+		RedisPoolSize:       10,
+		WriteCoalesceWindow: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	k := cache.cacheKey("dish", "42")
+	cache.rdb.Del(ctx, k)
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+	writes := func() int {
+		counter.mu.Lock()
+		defer counter.mu.Unlock()
+		n := 0
+		for _, arg := range append(counter.commands["evalsha"], counter.commands["eval"]...) {
+			if arg == setScript.Hash() || strings.Contains(arg, `redis.call("SET"`) {
+				n++
+			}
+		}
+		return n
+	}
+
+	var dish Dish
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, cache.Set(ctx, &Dish{ID: 42, Price: float64(i)}))
+		assert.Nil(t, cache.Get(ctx, "42", &dish))
+		assert.Equal(t, float64(i), dish.Price)
+	}
+	assert.Equal(t, 0, writes())
+	assert.Eventually(t, func() bool {
+		return writes() == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, cache.Get(ctx, "42", &dish, SkipLocal()))
+	assert.Equal(t, float64(10), dish.Price)
+
+	// closing flushes the writes still pending
+	assert.Nil(t, cache.Set(ctx, &Dish{ID: 42, Price: 11}))
+	assert.Nil(t, cache.Close())
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+	content, _ := client.Get(ctx, k).Result()
+	assert.Equal(t, toJson(&Dish{ID: 42, Price: 11}), content)
+	// once closed nothing is coalesced any more
+	assert.True(t, errors.Is(cache.Set(ctx, &Dish{ID: 42, Price: 12}), ErrClosed))
+}
+
+func TestLevelCache_MSet(t *testing.T) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+		MaxValueBytes: 100,
+	})
+	if err != nil {
+		t.Errorf("init cache fail:%+v", err)
+		return
+	}
+	ctx := context.TODO()
+	loads := 0
+	_ = cache.RegisterLoader("dish", func(ctx context.Context, key string) (Cacheable, error) {
+		loads++
+		return GetDish(ctx, key)
+	})
+	counter := &commandCounter{commands: make(map[string][]string)}
+	cache.rdb.AddHook(counter)
+
+	objs := []Cacheable{&Dish{ID: 58, Name: "a"}, &Dish{ID: 59, Name: "b"}, &Drink{ID: 58, Name: "c"}}
+	assert.Nil(t, cache.MSet(ctx, objs))
+	assert.Len(t, counter.commands["pipeline"], 2)
+	assert.Empty(t, counter.commands["set"])
+	for _, obj := range objs {
+		v, err := cache.currentVersion(ctx, obj.Namespace(), obj.Key())
+		assert.Nil(t, err)
+		assert.True(t, v > 0)
+	}
+
+	var dish Dish
+	var drink Drink
+	for _, key := range []string{"58", "59"} {
+		cache.c.Delete(cache.cacheKey("dish", key))
+		assert.Nil(t, cache.Get(ctx, key, &dish))
+	}
+	assert.Equal(t, "b", dish.Name)
+	assert.Nil(t, cache.Get(ctx, "58", &drink))
+	assert.Equal(t, "c", drink.Name)
+	assert.Zero(t, loads)
+
+	err = cache.MSet(ctx, []Cacheable{nil, &Dish{ID: 60, Comment: strings.Repeat("x", 100)}, &Dish{ID: 61}})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "#0")
+	assert.Contains(t, err.Error(), "[dish] 60")
+	assert.Nil(t, cache.rdb.Get(ctx, cache.cacheKey("dish", "61")).Err())
+}
+
+func benchmarkSet(b *testing.B, set func(cache *LevelCache, objs []Cacheable)) {
+	cache, err := New(CacheConfig{
+		RedisAddr:     "localhost:6379",
+		RedisPoolSize: 10,
+	})
+	if err != nil {
+		b.Fatalf("init cache fail:%+v", err)
+	}
+	objs := make([]Cacheable, 100)
+	for i := range objs {
+		objs[i] = &bulkDish{Dish{ID: i}}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set(cache, objs)
+	}
+}
+
+func BenchmarkLevelCache_MSet(b *testing.B) {
+	benchmarkSet(b, func(cache *LevelCache, objs []Cacheable) {
+		_ = cache.MSet(context.TODO(), objs)
+	})
+}
+
+func BenchmarkLevelCache_SetEach(b *testing.B) {
+	benchmarkSet(b, func(cache *LevelCache, objs []Cacheable) {
+		for _, obj := range objs {
+			_ = cache.Set(context.TODO(), obj)
+		}
+	})
+}